@@ -0,0 +1,129 @@
+// Copyright © 2018 Yale University
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/YaleUniversity/go-filelocker/pkg/filelocker"
+
+	"github.com/pkg/errors"
+
+	"github.com/spf13/cobra"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// readMessageBody returns the message body from --body, --body-file, stdin (-b -) or,
+// when none are given and stdin is a terminal, from $EDITOR
+func readMessageBody(cmd *cobra.Command) (string, error) {
+	var body []byte
+	var err error
+
+	switch {
+	case bodyFile != "" && cmd.Flags().Changed("body"):
+		return "", errors.New("only one of --body and --body-file can be given")
+	case bodyFile != "":
+		body, err = readLimited(bodyFile)
+	case messageBody == "-":
+		body, err = readAllLimited(os.Stdin)
+	case cmd.Flags().Changed("body"):
+		body = []byte(messageBody)
+	case terminal.IsTerminal(int(os.Stdin.Fd())):
+		body, err = editBody()
+	default:
+		return "", errors.New("no message body, use --body, --body-file or '-b -' to read from stdin")
+	}
+
+	if err != nil {
+		return "", errors.Wrap(err, "unable to read message body")
+	}
+
+	if len(body) > filelocker.MaxMessageSize {
+		return "", fmt.Errorf("message body is larger than the maximum of %d bytes", filelocker.MaxMessageSize)
+	}
+
+	return string(body), nil
+}
+
+func readLimited(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return readAllLimited(f)
+}
+
+// readAllLimited reads one byte past the maximum message size so oversized bodies are
+// detected without reading all of a large input
+func readAllLimited(r io.Reader) ([]byte, error) {
+	return ioutil.ReadAll(io.LimitReader(r, filelocker.MaxMessageSize+1))
+}
+
+// editBody opens $VISUAL or $EDITOR (falling back to vi) on a private temporary file and
+// returns what was saved
+func editBody() ([]byte, error) {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	// ioutil.TempFile creates the file with 0600 permissions
+	f, err := ioutil.TempFile("", "filelocker-message-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	c := exec.Command("sh", "-c", editor+` "$1"`, "sh", f.Name())
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		return nil, errors.Wrap(err, "editor failed")
+	}
+
+	body, err := readLimited(f.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	body = []byte(strings.TrimRight(string(body), "\n"))
+	if len(body) == 0 {
+		return nil, errors.New("aborting due to empty message body")
+	}
+
+	return body, nil
+}
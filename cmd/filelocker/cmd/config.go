@@ -0,0 +1,260 @@
+// Copyright © 2018 Yale University
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// configCmd represents the parent command for managing the config file
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage profiles in the config file",
+	Long: `Manage named profiles for filelocker servers and accounts in the config file.  A profile's
+settings override the top level settings in the config file, and it's selected with --profile,
+FILELOCKER_PROFILE or the profile setting in the config file.  Changes rewrite the config file
+with 0600 permissions, dropping any comments.`,
+	// managing profiles doesn't need a filelocker session
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error { return nil },
+}
+
+// configListCmd represents the command to list profiles
+var configListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List profiles, marking the default with *",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := readConfigFile()
+		if err != nil {
+			return err
+		}
+
+		profiles := configProfiles(config)
+		names := make([]string, 0, len(profiles))
+		for name := range profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			p, _ := profiles[name].(map[interface{}]interface{})
+
+			current := " "
+			if name == config["profile"] {
+				current = "*"
+			}
+			fmt.Printf("%s %s | URL: %v | Login: %v\n", current, name, p["url"], p["login"])
+		}
+		return nil
+	},
+}
+
+// configAddCmd represents the command to add a profile
+var configAddCmd = &cobra.Command{
+	Use:   "add <name>",
+	Short: "Add or replace a profile with the --url, --login and --key (or --key-file, etc.) flags",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if filelockerURL == "" {
+			return errors.New("filelocker URL is required")
+		}
+
+		config, err := readConfigFile()
+		if err != nil {
+			return err
+		}
+
+		p := map[interface{}]interface{}{"url": filelockerURL}
+		if userID != "" {
+			p["login"] = userID
+		}
+
+		if apiKey != "" {
+			p["key"] = apiKey
+		}
+
+		if keyFile != "" {
+			p["key_file"] = keyFile
+		}
+
+		if keyCommand != "" {
+			p["key_command"] = keyCommand
+		}
+
+		if useKeyring {
+			p["keyring"] = true
+		}
+
+		if keyEncryptedFile != "" {
+			p["key_encrypted_file"] = keyEncryptedFile
+		}
+
+		profiles := configProfiles(config)
+		profiles[args[0]] = p
+		config["profiles"] = profiles
+
+		if _, ok := config["profile"]; !ok {
+			config["profile"] = args[0]
+		}
+
+		return writeConfigFile(config)
+	},
+}
+
+// configUseCmd represents the command to set the default profile
+var configUseCmd = &cobra.Command{
+	Use:   "use <name>",
+	Short: "Set the default profile",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := readConfigFile()
+		if err != nil {
+			return err
+		}
+
+		if _, ok := configProfiles(config)[args[0]]; !ok {
+			return errors.Errorf("profile %s not found", args[0])
+		}
+		config["profile"] = args[0]
+
+		return writeConfigFile(config)
+	},
+}
+
+// configRemoveCmd represents the command to remove a profile
+var configRemoveCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "Remove a profile",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := readConfigFile()
+		if err != nil {
+			return err
+		}
+
+		profiles := configProfiles(config)
+		if _, ok := profiles[args[0]]; !ok {
+			return errors.Errorf("profile %s not found", args[0])
+		}
+		delete(profiles, args[0])
+		config["profiles"] = profiles
+
+		if config["profile"] == args[0] {
+			delete(config, "profile")
+		}
+
+		return writeConfigFile(config)
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configListCmd)
+	configCmd.AddCommand(configAddCmd)
+	configCmd.AddCommand(configUseCmd)
+	configCmd.AddCommand(configRemoveCmd)
+	RootCmd.AddCommand(configCmd)
+}
+
+// applyProfile merges the selected profile over the top level settings of the config file
+func applyProfile(v *viper.Viper, cmd *cobra.Command) error {
+	name := v.GetString("profile")
+	if f := cmd.Flags().Lookup("profile"); f != nil && f.Changed {
+		name = f.Value.String()
+	}
+
+	if name == "" {
+		return nil
+	}
+
+	p := v.GetStringMap("profiles." + name)
+	if len(p) == 0 {
+		return errors.Errorf("profile %s not found", name)
+	}
+
+	return v.MergeConfigMap(p)
+}
+
+// configFile returns the path of the config file
+func configFile() string {
+	if cfgFile != "" {
+		return cfgFile
+	}
+
+	if used := viper.ConfigFileUsed(); used != "" {
+		return used
+	}
+
+	return filepath.Join(os.Getenv("HOME"), ".filelocker.yaml")
+}
+
+func readConfigFile() (map[string]interface{}, error) {
+	config := map[string]interface{}{}
+
+	data, err := ioutil.ReadFile(configFile())
+	if os.IsNotExist(err) {
+		return config, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "unable to read config file")
+	}
+
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, errors.Wrap(err, "unable to parse config file")
+	}
+
+	return config, nil
+}
+
+func writeConfigFile(config map[string]interface{}) error {
+	out, err := yaml.Marshal(config)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal config file")
+	}
+
+	// the config file holds api keys
+	path := configFile()
+	if err := ioutil.WriteFile(path, out, 0600); err != nil {
+		return errors.Wrap(err, "unable to write config file")
+	}
+
+	return os.Chmod(path, 0600)
+}
+
+// configProfiles returns the profiles in the config file
+func configProfiles(config map[string]interface{}) map[string]interface{} {
+	profiles := map[string]interface{}{}
+	if m, ok := config["profiles"].(map[interface{}]interface{}); ok {
+		for k, v := range m {
+			profiles[fmt.Sprint(k)] = v
+		}
+	}
+	return profiles
+}
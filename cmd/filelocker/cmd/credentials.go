@@ -0,0 +1,77 @@
+// Copyright © 2018 Yale University
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/YaleUniversity/go-filelocker/pkg/filelocker"
+
+	"github.com/pkg/errors"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+var keyFile, keyCommand, keyEncryptedFile string
+var useKeyring bool
+
+func init() {
+	RootCmd.PersistentFlags().StringVar(&keyFile, "key-file", "", "Read the api key from a file that only you can read")
+	RootCmd.PersistentFlags().StringVar(&keyCommand, "key-command", "", "Run a command, like a password manager, that prints the api key")
+	RootCmd.PersistentFlags().BoolVar(&useKeyring, "keyring", false, "Look up the api key in the OS keyring (secret-tool or the macOS keychain)")
+	RootCmd.PersistentFlags().StringVar(&keyEncryptedFile, "key-encrypted-file", "", "Read the api key from a file encrypted with an age passphrase")
+}
+
+// credentials returns where to get the api key from, preferring --key, then --key-file,
+// --key-command, --keyring and --key-encrypted-file
+func credentials() (filelocker.CredentialsProvider, error) {
+	switch {
+	case apiKey != "":
+		return filelocker.StaticCredentials{UserID: userID, APIKey: apiKey}, nil
+	case keyFile != "":
+		return filelocker.KeyFileCredentials{UserID: userID, Path: keyFile}, nil
+	case keyCommand != "":
+		return filelocker.CommandCredentials{UserID: userID, Command: keyCommand}, nil
+	case useKeyring:
+		return filelocker.KeyringCredentials{UserID: userID}, nil
+	case keyEncryptedFile != "":
+		return filelocker.EncryptedFileCredentials{UserID: userID, Path: keyEncryptedFile, Passphrase: keyPassphrase}, nil
+	}
+
+	return nil, errors.New("an api key is required, use --key, --key-file, --key-command, --keyring or --key-encrypted-file")
+}
+
+// keyPassphrase reads the passphrase for the encrypted key file from FILELOCKER_KEY_PASSPHRASE or prompts for it
+func keyPassphrase() ([]byte, error) {
+	if p, ok := os.LookupEnv("FILELOCKER_KEY_PASSPHRASE"); ok {
+		return []byte(p), nil
+	}
+
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, errors.New("no passphrase for the encrypted key file, set FILELOCKER_KEY_PASSPHRASE")
+	}
+
+	fmt.Fprint(os.Stderr, "Key file passphrase: ")
+	pass, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	return pass, err
+}
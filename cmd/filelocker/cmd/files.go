@@ -0,0 +1,476 @@
+// Copyright © 2018 Yale University
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/YaleUniversity/go-filelocker/pkg/filelocker"
+
+	"github.com/pkg/errors"
+
+	"github.com/spf13/cobra"
+
+	"filippo.io/age"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+var uploadName, uploadNotes, uploadExpire, downloadOutput string
+var updateName, updateNotes, updateExpire string
+var waitScan, waitScanInterval string
+var encryptTo, identityFiles []string
+var uploadScan, usePassphrase, listShared bool
+var listTags, removeTags []string
+
+// filesCmd represents the parent command for working with files
+var filesCmd = &cobra.Command{
+	Use:   "files",
+	Short: "Work with files",
+}
+
+// filesListCmd represents the command to list files
+var filesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List your files, or files shared with you, optionally filtered by tag",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tags, err := parseTags(listTags)
+		if err != nil {
+			return err
+		}
+
+		list := filelockerClient.Files
+		if listShared {
+			list = filelockerClient.SharedFiles
+		}
+
+		resp, err := list()
+		if err != nil {
+			return errors.Wrap(err, "unable to list files")
+		}
+		files := resp.Tagged(tags)
+
+		if asJSON {
+			out, jsonErr := json.MarshalIndent(files, "", "    ")
+			if jsonErr != nil {
+				return errors.Wrap(jsonErr, "unable to marshal files into JSON")
+			}
+			fmt.Println(string(out))
+			return nil
+		}
+
+		for _, f := range files {
+			fmt.Printf("ID: %s | Name: %s | Size: %d | Expiration: %s%s\n", f.ID, f.Name, f.Size, f.Expiration, tagSummary(f.Metadata))
+		}
+		return nil
+	},
+}
+
+// filesTagCmd represents the command to tag a file
+var filesTagCmd = &cobra.Command{
+	Use:   "tag <id> [key=value]...",
+	Short: "Set or remove tags in a file's notes",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tags, err := parseTags(args[1:])
+		if err != nil {
+			return err
+		}
+
+		if len(tags) == 0 && len(removeTags) == 0 {
+			return errors.New("no tags to set or remove")
+		}
+
+		if _, err := filelockerClient.TagFile(args[0], tags, removeTags...); err != nil {
+			return errors.Wrap(err, "unable to tag file")
+		}
+
+		fmt.Printf("Tagged %s\n", args[0])
+		return nil
+	},
+}
+
+// filesUpdateCmd represents the command to update a file
+var filesUpdateCmd = &cobra.Command{
+	Use:   "update <id>",
+	Short: "Rename a file, or change its notes or expiration",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		update := filelocker.FileUpdate{Name: updateName}
+
+		if updateExpire != "" {
+			expire, err := parseExpiration(updateExpire, "")
+			if err != nil {
+				return errors.Wrap(err, "invalid expiration")
+			}
+			update.Expiration = expire
+		}
+
+		if cmd.Flags().Changed("notes") {
+			resp, err := filelockerClient.Files()
+			if err != nil {
+				return errors.Wrap(err, "unable to list files")
+			}
+
+			var file *filelocker.File
+			for i := range resp.Files {
+				if resp.Files[i].ID == args[0] {
+					file = &resp.Files[i]
+				}
+			}
+
+			if file == nil {
+				return errors.Errorf("file %s not found", args[0])
+			}
+
+			// replace the text of the notes, keeping the tags and checksum
+			notes := filelocker.FormatNotes(updateNotes, file.Metadata)
+			update.Notes = &notes
+		}
+
+		if update.Name == "" && update.Notes == nil && update.Expiration.IsZero() {
+			return errors.New("nothing to update, use --name, --notes or --expire")
+		}
+
+		if _, err := filelockerClient.UpdateFile(args[0], update); err != nil {
+			return errors.Wrap(err, "unable to update file")
+		}
+
+		fmt.Printf("Updated %s\n", args[0])
+		return nil
+	},
+}
+
+// filesUploadCmd represents the command to upload a file
+var filesUploadCmd = &cobra.Command{
+	Use:   "upload <path>",
+	Short: "Upload a file, optionally encrypting it first",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		recipients, err := fileRecipients()
+		if err != nil {
+			return err
+		}
+
+		if len(recipients) > 0 {
+			filelockerClient.FileEncryption = &filelocker.FileEncryption{Recipients: recipients}
+		}
+
+		var expire time.Time
+		if uploadExpire != "" {
+			if expire, err = parseExpiration(uploadExpire, ""); err != nil {
+				return errors.Wrap(err, "invalid expiration")
+			}
+		}
+
+		f, err := os.Open(args[0])
+		if err != nil {
+			return errors.Wrap(err, "unable to open file")
+		}
+		defer f.Close()
+
+		name := uploadName
+		if name == "" {
+			name = filepath.Base(args[0])
+		}
+
+		resp, err := filelockerClient.UploadWithOptions(name, f, filelocker.UploadOptions{
+			Notes:      uploadNotes,
+			Scan:       uploadScan || waitScan != "",
+			Expiration: expire,
+		})
+		if err != nil {
+			return errors.Wrap(err, "unable to upload file")
+		}
+
+		if waitScan != "" {
+			scanned, err := waitForScan(resp.File.ID)
+			if err != nil {
+				return err
+			}
+			resp.File = *scanned
+		}
+
+		if asJSON {
+			out, jsonErr := json.MarshalIndent(resp.File, "", "    ")
+			if jsonErr != nil {
+				return errors.Wrap(jsonErr, "unable to marshal file into JSON")
+			}
+			fmt.Println(string(out))
+			return nil
+		}
+
+		if waitScan != "" {
+			fmt.Printf("Uploaded %s | ID: %s | passed virus scan\n", name, resp.File.ID)
+			return nil
+		}
+
+		fmt.Printf("Uploaded %s | ID: %s\n", name, resp.File.ID)
+		return nil
+	},
+}
+
+// filesDownloadCmd represents the command to download a file
+var filesDownloadCmd = &cobra.Command{
+	Use:   "download <id>",
+	Short: "Download a file, decrypting it when it was encrypted on upload",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		identities, err := fileIdentities()
+		if err != nil {
+			return err
+		}
+
+		if len(identities) > 0 {
+			filelockerClient.FileEncryption = &filelocker.FileEncryption{Identities: identities}
+		}
+
+		if downloadOutput == "-" {
+			resp, err := filelockerClient.Download(args[0], os.Stdout)
+			if _, ok := err.(*filelocker.ChecksumError); ok {
+				return errors.Wrap(err, "the downloaded file is corrupt, discard the output")
+			}
+			if err != nil {
+				return errors.Wrap(err, "unable to download file")
+			}
+			warnEncrypted(resp)
+			return nil
+		}
+
+		// download next to the destination and only move it into place once it's complete
+		dir := "."
+		if downloadOutput != "" {
+			dir = filepath.Dir(downloadOutput)
+		}
+
+		tmp, err := ioutil.TempFile(dir, ".filelocker-download-")
+		if err != nil {
+			return errors.Wrap(err, "unable to create file")
+		}
+		defer os.Remove(tmp.Name())
+
+		resp, err := filelockerClient.Download(args[0], tmp)
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if _, ok := err.(*filelocker.ChecksumError); ok {
+			return errors.Wrap(err, "the downloaded file is corrupt and was discarded")
+		}
+		if err != nil {
+			return errors.Wrap(err, "unable to download file")
+		}
+
+		output := downloadOutput
+		if output == "" {
+			output = filepath.Base(resp.Name)
+		}
+
+		if err := os.Rename(tmp.Name(), output); err != nil {
+			return errors.Wrap(err, "unable to save file")
+		}
+
+		warnEncrypted(resp)
+		if resp.Verified {
+			fmt.Printf("Downloaded %s | %d bytes | sha256 verified\n", output, resp.Size)
+		} else {
+			fmt.Printf("Downloaded %s | %d bytes\n", output, resp.Size)
+		}
+		return nil
+	},
+}
+
+func init() {
+	filesListCmd.Flags().StringArrayVar(&listTags, "tag", []string{}, "Only list files with the tag, as key=value")
+	filesListCmd.Flags().BoolVar(&listShared, "shared", false, "List files shared with you instead of your files")
+	filesTagCmd.Flags().StringArrayVar(&removeTags, "remove", []string{}, "Remove the tag with this key")
+	filesUploadCmd.Flags().StringVarP(&uploadName, "name", "n", "", "The name of the file in filelocker, defaults to the file's name")
+	filesUploadCmd.Flags().StringVar(&uploadNotes, "notes", "", "Notes about the file, the file's checksum is appended to them")
+	filesUploadCmd.Flags().BoolVar(&uploadScan, "scan", false, "Virus scan the file after upload")
+	filesUploadCmd.Flags().StringVar(&waitScan, "wait-scan", "", "Scan the file and wait up to this long for the scan to finish, exiting with status 3 if it fails and 2 if it doesn't finish")
+	filesUploadCmd.Flags().StringVar(&waitScanInterval, "wait-scan-interval", "10s", "How often to check whether the virus scan has finished")
+	filesUploadCmd.Flags().StringVarP(&uploadExpire, "expire", "e", "", "When the file expires, as a duration from now or a date (ie. 5d, 2026-12-31).  Defaults to the server's default")
+	filesUploadCmd.Flags().StringArrayVar(&encryptTo, "encrypt-to", []string{}, "Encrypt the file to an age X25519 recipient (age1...) before uploading")
+	filesUploadCmd.Flags().BoolVar(&usePassphrase, "passphrase", false, "Encrypt the file with a passphrase before uploading")
+	filesUpdateCmd.Flags().StringVarP(&updateName, "name", "n", "", "Rename the file")
+	filesUpdateCmd.Flags().StringVar(&updateNotes, "notes", "", "Replace the file's notes, keeping its tags and checksum")
+	filesUpdateCmd.Flags().StringVarP(&updateExpire, "expire", "e", "", "Change when the file expires, as a duration from now or a date (ie. 5d, 2026-12-31)")
+	filesDownloadCmd.Flags().StringVarP(&downloadOutput, "output", "o", "", "Where to save the file, or '-' for stdout.  Defaults to the file's name")
+	filesDownloadCmd.Flags().StringArrayVarP(&identityFiles, "identity", "i", []string{}, "age identity file used to decrypt encrypted files")
+	filesDownloadCmd.Flags().BoolVar(&usePassphrase, "passphrase", false, "Decrypt the file with a passphrase")
+	filesCmd.AddCommand(filesListCmd)
+	filesCmd.AddCommand(filesTagCmd)
+	filesCmd.AddCommand(filesUpdateCmd)
+	filesCmd.AddCommand(filesUploadCmd)
+	filesCmd.AddCommand(filesDownloadCmd)
+	RootCmd.AddCommand(filesCmd)
+}
+
+// waitForScan blocks until the uploaded file's virus scan finishes or the --wait-scan timeout elapses
+func waitForScan(fileID string) (*filelocker.File, error) {
+	timeout, err := time.ParseDuration(waitScan)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse wait scan timeout")
+	}
+
+	interval, err := time.ParseDuration(waitScanInterval)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse wait scan interval")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	f, err := filelockerClient.WaitForScan(ctx, fileID, interval)
+	switch {
+	case err == filelocker.ErrFailedAvScan:
+		return nil, &exitError{fmt.Errorf("file %s failed its virus scan", fileID), 3}
+	case err == context.DeadlineExceeded:
+		return nil, &exitError{fmt.Errorf("virus scan of file %s didn't finish within %s", fileID, timeout), 2}
+	case err != nil:
+		return nil, errors.Wrap(err, "unable to check virus scan")
+	}
+
+	return f, nil
+}
+
+// parseTags parses key=value tags
+func parseTags(in []string) (map[string]string, error) {
+	tags := map[string]string{}
+	for _, t := range in {
+		kv := strings.SplitN(t, "=", 2)
+		if len(kv) != 2 || !filelocker.ValidMetadataKey(kv[0]) {
+			return nil, errors.Errorf("invalid tag %q, expected key=value", t)
+		}
+		tags[kv[0]] = kv[1]
+	}
+	return tags, nil
+}
+
+// tagSummary describes a file's tags, leaving out the checksum
+func tagSummary(meta map[string]string) string {
+	var tags []string
+	for k, v := range meta {
+		if !filelocker.ReservedMetadataKey(k) {
+			tags = append(tags, k+"="+v)
+		}
+	}
+
+	if len(tags) == 0 {
+		return ""
+	}
+
+	sort.Strings(tags)
+	return " | Tags: " + strings.Join(tags, ", ")
+}
+
+// fileRecipients returns the age recipients to encrypt uploads to
+func fileRecipients() ([]age.Recipient, error) {
+	var recipients []age.Recipient
+	for _, r := range encryptTo {
+		recipient, err := age.ParseX25519Recipient(r)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid recipient %s", r)
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	if usePassphrase {
+		if len(recipients) > 0 {
+			return nil, errors.New("--passphrase can't be used with --encrypt-to")
+		}
+
+		pass, err := filePassphrase()
+		if err != nil {
+			return nil, err
+		}
+
+		recipient, err := age.NewScryptRecipient(pass)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	return recipients, nil
+}
+
+// fileIdentities returns the age identities to decrypt downloads with
+func fileIdentities() ([]age.Identity, error) {
+	var identities []age.Identity
+	for _, path := range identityFiles {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to open identity file")
+		}
+
+		ids, err := age.ParseIdentities(f)
+		f.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid identity file %s", path)
+		}
+		identities = append(identities, ids...)
+	}
+
+	if usePassphrase {
+		pass, err := filePassphrase()
+		if err != nil {
+			return nil, err
+		}
+
+		identity, err := age.NewScryptIdentity(pass)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+
+	return identities, nil
+}
+
+// filePassphrase reads the file encryption passphrase from FILELOCKER_FILE_PASSPHRASE or prompts for it
+func filePassphrase() (string, error) {
+	if p, ok := os.LookupEnv("FILELOCKER_FILE_PASSPHRASE"); ok {
+		return p, nil
+	}
+
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return "", errors.New("no passphrase, set FILELOCKER_FILE_PASSPHRASE")
+	}
+
+	fmt.Fprint(os.Stderr, "File passphrase: ")
+	pass, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	return string(pass), err
+}
+
+func warnEncrypted(resp *filelocker.DownloadResponse) {
+	if resp.Encrypted && !resp.Decrypted {
+		Logger.Println("warning: the file is encrypted, use --identity or --passphrase to decrypt it")
+	}
+}
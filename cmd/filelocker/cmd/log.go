@@ -0,0 +1,114 @@
+// Copyright © 2018 Yale University
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/YaleUniversity/go-filelocker/pkg/filelocker"
+)
+
+const (
+	levelDebug = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var levelNames = []string{"DEBUG", "INFO", "WARN", "ERROR"}
+
+var trace bool
+var traceFile string
+
+// traceOut is where requests and responses are traced, if anywhere
+var traceOut io.Writer
+
+// eventLogger logs the filelocker client's events at or above a level to STDERR in the same
+// key=value format as slog's text handler
+type eventLogger struct {
+	level int
+}
+
+// clientLogger returns the logger for the --verbose and --debug flags, or nil when neither is set
+func clientLogger() filelocker.Logger {
+	switch {
+	case debug:
+		return &eventLogger{level: levelDebug}
+	case verbose:
+		return &eventLogger{level: levelInfo}
+	}
+	return nil
+}
+
+func (l *eventLogger) Debug(msg string, args ...interface{}) { l.log(levelDebug, msg, args) }
+func (l *eventLogger) Info(msg string, args ...interface{})  { l.log(levelInfo, msg, args) }
+func (l *eventLogger) Warn(msg string, args ...interface{})  { l.log(levelWarn, msg, args) }
+func (l *eventLogger) Error(msg string, args ...interface{}) { l.log(levelError, msg, args) }
+
+func (l *eventLogger) log(level int, msg string, args []interface{}) {
+	if level < l.level {
+		return
+	}
+
+	line := []string{
+		"time=" + time.Now().Format(time.RFC3339),
+		"level=" + levelNames[level],
+		"msg=" + quoteValue(msg),
+	}
+	for i := 0; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			line = append(line, fmt.Sprintf("!BADKEY=%s", quoteValue(fmt.Sprint(args[i]))))
+			break
+		}
+		line = append(line, fmt.Sprintf("%v=%s", args[i], quoteValue(fmt.Sprint(args[i+1]))))
+	}
+
+	Logger.Println(strings.Join(line, " "))
+}
+
+// quoteValue quotes log values that are empty or contain spaces, quotes or equals signs
+func quoteValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// openTrace sets where requests and responses are traced for --trace and --trace-file.  The trace
+// file is appended to, and created readable only by the user.
+func openTrace() error {
+	switch {
+	case traceFile != "":
+		f, err := os.OpenFile(traceFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return err
+		}
+		traceOut = f
+	case trace:
+		traceOut = os.Stderr
+	}
+	return nil
+}
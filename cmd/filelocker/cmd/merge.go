@@ -0,0 +1,231 @@
+// Copyright © 2018 Yale University
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var mergeFile, mergeTemplate, mergeRecipientColumn string
+var mergeDryRun bool
+var mergeConcurrency int
+
+// mergeMessage is a secure message rendered from a row of the merge CSV
+type mergeMessage struct {
+	Row       int    `json:"row"`
+	Recipient string `json:"recipient"`
+	Subject   string `json:"subject"`
+	body      string
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+}
+
+// runMerge renders and sends one secure message per row of the --merge CSV
+func runMerge() error {
+	if mergeTemplate == "" {
+		return errors.New("--template is required with --merge")
+	}
+
+	if len(recipientList) > 0 {
+		return errors.New("recipients come from the merge CSV, --recipient can't be used with --merge")
+	}
+
+	if mergeConcurrency < 1 {
+		return errors.New("concurrency must be at least 1")
+	}
+
+	expire, err := parseExpiration(expireIn, expireOn)
+	if err != nil {
+		return err
+	}
+
+	tmpl, err := ioutil.ReadFile(mergeTemplate)
+	if err != nil {
+		return errors.Wrap(err, "unable to read template")
+	}
+
+	bodyTmpl, err := template.New("body").Option("missingkey=error").Parse(string(tmpl))
+	if err != nil {
+		return errors.Wrap(err, "unable to parse template")
+	}
+
+	subjectTmpl, err := template.New("subject").Option("missingkey=error").Parse(messageSubject)
+	if err != nil {
+		return errors.Wrap(err, "unable to parse subject template")
+	}
+
+	f, err := os.Open(mergeFile)
+	if err != nil {
+		return errors.Wrap(err, "unable to open merge file")
+	}
+	defer f.Close()
+
+	msgs, err := renderMerge(f, subjectTmpl, bodyTmpl)
+	if err != nil {
+		return err
+	}
+
+	if mergeDryRun {
+		for _, m := range msgs {
+			if m.Error != "" {
+				fmt.Printf("--- row %d: %s\n", m.Row, m.Error)
+				continue
+			}
+			fmt.Printf("--- row %d | To: %s | Subject: %s\n%s\n", m.Row, m.Recipient, m.Subject, m.body)
+		}
+		return nil
+	}
+
+	sendMerge(msgs, expire)
+	return mergeReport(msgs)
+}
+
+// renderMerge renders the subject and body templates for each row of the CSV
+func renderMerge(r io.Reader, subjectTmpl, bodyTmpl *template.Template) ([]*mergeMessage, error) {
+	rows := csv.NewReader(r)
+
+	header, err := rows.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read merge file header")
+	}
+
+	recipientIndex := -1
+	for i, h := range header {
+		header[i] = strings.TrimSpace(h)
+		if header[i] == mergeRecipientColumn {
+			recipientIndex = i
+		}
+	}
+
+	if recipientIndex < 0 {
+		return nil, fmt.Errorf("merge file has no %q column", mergeRecipientColumn)
+	}
+
+	var msgs []*mergeMessage
+	for line := 2; ; line++ {
+		record, err := rows.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrap(err, "unable to read merge file")
+		}
+
+		data := make(map[string]string)
+		for i, h := range header {
+			data[h] = record[i]
+		}
+
+		m := &mergeMessage{Row: line, Recipient: strings.TrimSpace(record[recipientIndex])}
+		msgs = append(msgs, m)
+
+		if m.Recipient == "" {
+			m.Status, m.Error = "failed", "no recipient"
+			continue
+		}
+
+		var subject, body bytes.Buffer
+		if err := subjectTmpl.Execute(&subject, data); err != nil {
+			m.Status, m.Error = "failed", err.Error()
+			continue
+		}
+
+		if err := bodyTmpl.Execute(&body, data); err != nil {
+			m.Status, m.Error = "failed", err.Error()
+			continue
+		}
+
+		m.Subject = subject.String()
+		m.body = body.String()
+	}
+
+	return msgs, nil
+}
+
+// sendMerge sends the rendered messages with up to --concurrency in flight
+func sendMerge(msgs []*mergeMessage, expire time.Time) {
+	sem := make(chan struct{}, mergeConcurrency)
+	var wg sync.WaitGroup
+	for _, m := range msgs {
+		if m.Error != "" {
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(m *mergeMessage) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			if _, err := filelockerClient.NewSecureMessage(m.Subject, m.body, []string{m.Recipient}, expire); err != nil {
+				m.Status, m.Error = "failed", err.Error()
+				return
+			}
+			m.Status = "sent"
+		}(m)
+	}
+	wg.Wait()
+}
+
+// mergeReport prints the result of each row and returns an error if any failed
+func mergeReport(msgs []*mergeMessage) error {
+	var failed int
+	for _, m := range msgs {
+		if m.Error != "" {
+			failed++
+		}
+	}
+
+	if asJSON {
+		out, err := json.MarshalIndent(msgs, "", "    ")
+		if err != nil {
+			return errors.Wrap(err, "unable to marshal report into JSON")
+		}
+		fmt.Println(string(out))
+	} else {
+		for _, m := range msgs {
+			if m.Error != "" {
+				fmt.Printf("row %d | %s | %s: %s\n", m.Row, m.Recipient, m.Status, m.Error)
+				continue
+			}
+			fmt.Printf("row %d | %s | %s\n", m.Row, m.Recipient, m.Status)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d secure messages failed", failed, len(msgs))
+	}
+
+	return nil
+}
@@ -0,0 +1,203 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/YaleUniversity/go-filelocker/pkg/filelocker"
+)
+
+// captureStdout returns what f prints to STDOUT
+func captureStdout(t *testing.T, f func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	f()
+	w.Close()
+
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestRenderMerge(t *testing.T) {
+	defer func(c string) { mergeRecipientColumn = c }(mergeRecipientColumn)
+	mergeRecipientColumn = "recipient"
+
+	tests := []struct {
+		name    string
+		csv     string
+		subject string
+		body    string
+		err     bool
+		results []mergeMessage
+	}{
+		{
+			name:    "rendered",
+			csv:     "recipient, name\nnetid123,Alice\n",
+			subject: "Hi {{.name}}",
+			body:    "Password for {{.recipient}}",
+			results: []mergeMessage{{Row: 2, Recipient: "netid123", Subject: "Hi Alice", body: "Password for netid123"}},
+		},
+		{
+			name:    "no recipient column",
+			csv:     "to,name\nnetid123,Alice\n",
+			subject: "Hi",
+			body:    "Hi",
+			err:     true,
+		},
+		{
+			name:    "template uses a missing column",
+			csv:     "recipient,name\nnetid123,Alice\n",
+			subject: "Hi {{.name}}",
+			body:    "Your password is {{.password}}",
+			results: []mergeMessage{{Row: 2, Recipient: "netid123", Status: "failed", Error: "map has no entry for key"}},
+		},
+		{
+			name:    "template error",
+			csv:     "recipient,name\nnetid123,Al\n",
+			subject: "Hi {{index .name 5}}",
+			body:    "Hi",
+			results: []mergeMessage{{Row: 2, Recipient: "netid123", Status: "failed", Error: "index out of range"}},
+		},
+		{
+			name:    "empty recipient",
+			csv:     "recipient,name\n ,Alice\nnetid456,Bob\n",
+			subject: "Hi {{.name}}",
+			body:    "Hi",
+			results: []mergeMessage{
+				{Row: 2, Status: "failed", Error: "no recipient"},
+				{Row: 3, Recipient: "netid456", Subject: "Hi Bob", body: "Hi"},
+			},
+		},
+		{
+			name:    "short row",
+			csv:     "recipient,name\nnetid123\n",
+			subject: "Hi",
+			body:    "Hi",
+			err:     true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			subjectTmpl := template.Must(template.New("subject").Option("missingkey=error").Parse(tc.subject))
+			bodyTmpl := template.Must(template.New("body").Option("missingkey=error").Parse(tc.body))
+
+			msgs, err := renderMerge(strings.NewReader(tc.csv), subjectTmpl, bodyTmpl)
+			if tc.err {
+				if err == nil {
+					t.Error("expected error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(msgs) != len(tc.results) {
+				t.Fatalf("expected %d messages, got %d", len(tc.results), len(msgs))
+			}
+
+			for i, expected := range tc.results {
+				m := msgs[i]
+				if m.Row != expected.Row || m.Recipient != expected.Recipient || m.Subject != expected.Subject || m.body != expected.body || m.Status != expected.Status {
+					t.Errorf("expected %+v, got %+v", expected, *m)
+				}
+
+				if !strings.Contains(m.Error, expected.Error) || (expected.Error == "") != (m.Error == "") {
+					t.Errorf("expected error %q, got %q", expected.Error, m.Error)
+				}
+			}
+		})
+	}
+}
+
+func TestSendMerge(t *testing.T) {
+	fl := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cli/CLI_login":
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte(`<cli_response><messages><info>origin</info></messages></cli_response>`))
+		case "/message/create_message":
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				t.Error(err)
+			}
+
+			values, err := url.ParseQuery(string(body))
+			if err != nil {
+				t.Error(err)
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			if values.Get("recipientIds") == "nobody" {
+				w.Write([]byte(`{"sMessages": [], "fMessages": ["recipient not found"]}`))
+				return
+			}
+			w.Write([]byte(`{"sMessages": ["sent"], "fMessages": []}`))
+		default:
+			t.Errorf("unexpected url %s", r.URL)
+		}
+	}))
+	defer fl.Close()
+
+	client, err := filelocker.NewClient("user", "key", fl.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(c *filelocker.Client, n int, j bool) { filelockerClient, mergeConcurrency, asJSON = c, n, j }(filelockerClient, mergeConcurrency, asJSON)
+	filelockerClient, mergeConcurrency, asJSON = client, 2, false
+
+	msgs := []*mergeMessage{
+		{Row: 2, Recipient: "netid123", Subject: "Hi", body: "Hi"},
+		{Row: 3, Status: "failed", Error: "no recipient"},
+		{Row: 4, Recipient: "nobody", Subject: "Hi", body: "Hi"},
+		{Row: 5, Recipient: "netid456", Subject: "Hi", body: "Hi"},
+	}
+
+	var reportErr error
+	out := captureStdout(t, func() {
+		sendMerge(msgs, time.Now())
+		reportErr = mergeReport(msgs)
+	})
+
+	expected := "row 2 | netid123 | sent\n" +
+		"row 3 |  | failed: no recipient\n" +
+		"row 4 | nobody | failed: error sending secure messages\n" +
+		"row 5 | netid456 | sent\n"
+	if out != expected {
+		t.Errorf("expected report\n%s\ngot\n%s", expected, out)
+	}
+
+	if reportErr == nil || reportErr.Error() != "2 of 4 secure messages failed" {
+		t.Errorf("expected 2 of 4 failed, got %v", reportErr)
+	}
+
+	sent := []*mergeMessage{{Row: 2, Recipient: "netid123", Subject: "Hi", body: "Hi"}}
+	captureStdout(t, func() {
+		sendMerge(sent, time.Now())
+		reportErr = mergeReport(sent)
+	})
+
+	if reportErr != nil {
+		t.Error("expected no error when every message was sent, got", reportErr)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright © 2018 Yale University
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/YaleUniversity/go-filelocker/pkg/filelocker"
+
+	"github.com/pkg/errors"
+
+	"github.com/spf13/cobra"
+)
+
+// messagesCmd represents the parent command for working with secure messages
+var messagesCmd = &cobra.Command{
+	Use:   "messages",
+	Short: "Work with secure messages",
+}
+
+// messagesStatusCmd represents the command to show whether a message has been viewed
+var messagesStatusCmd = &cobra.Command{
+	Use:   "status <id>",
+	Short: "Show whether a secure message has been viewed",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			return errors.Wrap(err, "invalid message id")
+		}
+
+		resp, err := filelockerClient.SecureMessages()
+		if err != nil {
+			return errors.Wrap(err, "unable to read secure messages")
+		}
+
+		m, ok := resp.Message(id)
+		if !ok {
+			return fmt.Errorf("secure message %d not found", id)
+		}
+
+		if asJSON {
+			out, jsonErr := json.MarshalIndent(m, "", "    ")
+			if jsonErr != nil {
+				return errors.Wrap(jsonErr, "unable to marshal message into JSON")
+			}
+			fmt.Println(string(out))
+			return nil
+		}
+
+		printMessageStatus(m)
+		return nil
+	},
+}
+
+func init() {
+	messagesCmd.AddCommand(messagesStatusCmd)
+	RootCmd.AddCommand(messagesCmd)
+}
+
+func printMessageStatus(m *filelocker.SecureMessage) {
+	viewed := m.Viewed
+	if viewed == "" {
+		viewed = "not viewed"
+	}
+	fmt.Printf("ID: %d | Subject: %s | Recipients: %s | Created: %s | Expiration: %s | Viewed: %s\n",
+		m.ID, m.Subject, strings.Join(m.Recipients, ","), m.Created, m.Expiration, viewed)
+}
+
+// sentMessageIDs returns the ids of the messages the user has sent
+func sentMessageIDs() (map[int]bool, error) {
+	resp, err := filelockerClient.SecureMessages()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[int]bool)
+	for _, m := range resp.Sent() {
+		ids[m.ID] = true
+	}
+	return ids, nil
+}
+
+// findSentMessage finds the message with the subject and recipients that was sent since the
+// before ids were listed, since filelocker doesn't return the id of a new message.  It fails
+// when more than one message matches, ie. when the same message was sent twice at once.
+func findSentMessage(subject string, recipients []string, before map[int]bool) (*filelocker.SecureMessage, error) {
+	resp, err := filelockerClient.SecureMessages()
+	if err != nil {
+		return nil, err
+	}
+
+	var found []filelocker.SecureMessage
+	for _, m := range resp.Sent() {
+		if before[m.ID] || m.Subject != subject || !sameRecipients(m.Recipients, recipients) {
+			continue
+		}
+		found = append(found, m)
+	}
+
+	if len(found) == 0 {
+		return nil, errors.New("unable to find sent secure message")
+	} else if len(found) > 1 {
+		return nil, fmt.Errorf("unable to tell which of %d matching secure messages was sent", len(found))
+	}
+
+	return &found[0], nil
+}
+
+func sameRecipients(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	set := make(map[string]bool)
+	for _, r := range a {
+		set[r] = true
+	}
+
+	for _, r := range b {
+		if !set[r] {
+			return false
+		}
+	}
+	return true
+}
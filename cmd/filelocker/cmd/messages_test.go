@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/YaleUniversity/go-filelocker/pkg/filelocker"
+)
+
+func TestFindSentMessage(t *testing.T) {
+	// message 1 was sent before, 2 and 3 are identical messages sent since, 4 went to someone else
+	fl := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/cli/CLI_login":
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte(`<cli_response><messages><info>origin</info></messages></cli_response>`))
+		case "/message/get_messages":
+			w.Write([]byte(`{"sMessages": [], "fMessages": [], "data": [[], [
+				{"id": 1, "subject": "alert", "messageRecipients": ["user1"]},
+				{"id": 2, "subject": "alert", "messageRecipients": ["user1"]},
+				{"id": 3, "subject": "alert", "messageRecipients": ["user1"]},
+				{"id": 4, "subject": "alert", "messageRecipients": ["user2"]}
+			]]}`))
+		default:
+			t.Errorf("unexpected url %s", r.URL)
+		}
+	}))
+	defer fl.Close()
+
+	client, err := filelocker.NewClient("user", "key", fl.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(c *filelocker.Client) { filelockerClient = c }(filelockerClient)
+	filelockerClient = client
+
+	m, err := findSentMessage("alert", []string{"user1"}, map[int]bool{1: true, 2: true, 4: true})
+	if err != nil {
+		t.Fatal("expected to find sent message, got", err)
+	}
+
+	if m.ID != 3 {
+		t.Errorf("expected message 3, got %d", m.ID)
+	}
+
+	if _, err := findSentMessage("alert", []string{"user1"}, map[int]bool{1: true}); err == nil {
+		t.Error("expected error when two new messages match")
+	}
+
+	if _, err := findSentMessage("alert", []string{"user1"}, map[int]bool{1: true, 2: true, 3: true}); err == nil {
+		t.Error("expected error when no new message matches")
+	}
+}
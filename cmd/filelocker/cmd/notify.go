@@ -0,0 +1,306 @@
+// Copyright © 2018 Yale University
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	mathrand "math/rand"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/YaleUniversity/go-filelocker/pkg/filelocker"
+
+	"github.com/pkg/errors"
+
+	"github.com/spf13/cobra"
+)
+
+var notifyWebhooks []string
+var notifySecret, notifyInterval, notifyExpiringWithin, notifyBackoff string
+var notifyRetries int
+var notifyBackfill, notifyIncludeBody bool
+
+// notifyCmd represents the webhook dispatcher daemon
+var notifyCmd = &cobra.Command{
+	Use:   "notify",
+	Short: "Send filelocker events to webhooks",
+	Long: `Polls filelocker for new and viewed secure messages, newly shared files and expiring files
+and POSTs a JSON payload for each event to the configured webhooks.
+
+Events are message.received, message.viewed, file.shared and file.expiring.  When a secret is
+given, the request body is signed with HMAC-SHA256 and the hex digest is sent in the
+X-Filelocker-Signature header as 'sha256=<digest>'.  Message bodies are only included in the
+payload with --include-body.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(notifyWebhooks) == 0 {
+			return errors.New("at least one webhook is required")
+		}
+
+		interval, err := time.ParseDuration(notifyInterval)
+		if err != nil {
+			return errors.Wrap(err, "unable to parse interval")
+		}
+
+		expiringWithin, err := time.ParseDuration(notifyExpiringWithin)
+		if err != nil {
+			return errors.Wrap(err, "unable to parse expiring within")
+		}
+
+		backoff, err := time.ParseDuration(notifyBackoff)
+		if err != nil {
+			return errors.Wrap(err, "unable to parse backoff")
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(sigs)
+		go func() {
+			select {
+			case <-sigs:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		watcher := &filelocker.Watcher{
+			Client:         filelockerClient,
+			Interval:       interval,
+			Backfill:       notifyBackfill,
+			Viewed:         true,
+			ExpiringWithin: expiringWithin,
+			OnError: func(err error) {
+				Logger.Println("error polling filelocker:", err)
+			},
+		}
+
+		d := &dispatcher{
+			client:  &http.Client{Timeout: 30 * time.Second},
+			secret:  []byte(notifySecret),
+			retries: notifyRetries,
+			backoff: backoff,
+		}
+
+		events := make(chan filelocker.Event)
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range events {
+				body, err := json.Marshal(newEventPayload(e, notifyIncludeBody))
+				if err != nil {
+					Logger.Println("unable to marshal event into JSON:", err)
+					continue
+				}
+
+				for _, hook := range notifyWebhooks {
+					wg.Add(1)
+					go func(hook string, e filelocker.Event) {
+						defer wg.Done()
+						if err := d.deliver(ctx, hook, e.Type, body); err != nil {
+							Logger.Println(err)
+						}
+					}(hook, e)
+				}
+			}
+		}()
+
+		err = watcher.Watch(ctx, events)
+		close(events)
+		wg.Wait()
+
+		if err == context.Canceled {
+			return nil
+		}
+		return err
+	},
+	TraverseChildren: true,
+}
+
+func init() {
+	notifyCmd.Flags().StringArrayVarP(&notifyWebhooks, "webhook", "w", []string{}, "Webhook URL(s) to POST events to")
+	notifyCmd.Flags().StringVar(&notifySecret, "secret", "", "Secret used to sign webhook payloads")
+	notifyCmd.Flags().StringVarP(&notifyInterval, "interval", "i", "1m", "How often to poll filelocker")
+	notifyCmd.Flags().StringVar(&notifyExpiringWithin, "expiring-within", "72h", "Send file.expiring when an owned file expires within this long")
+	notifyCmd.Flags().IntVar(&notifyRetries, "retries", 5, "Number of times to retry a delivery that fails with a network error, a 5xx or a 429")
+	notifyCmd.Flags().StringVar(&notifyBackoff, "backoff", "1s", "Initial delay between delivery retries, doubled on each attempt")
+	notifyCmd.Flags().BoolVar(&notifyBackfill, "backfill", false, "Also send events for messages and files that exist when watching starts")
+	notifyCmd.Flags().BoolVar(&notifyIncludeBody, "include-body", false, "Include secure message bodies in the payload")
+	RootCmd.AddCommand(notifyCmd)
+}
+
+// eventPayload is the JSON body POSTed to webhooks
+type eventPayload struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+type messagePayload struct {
+	ID         int      `json:"id"`
+	Sender     string   `json:"sender"`
+	Recipients []string `json:"recipients"`
+	Subject    string   `json:"subject"`
+	Body       string   `json:"body,omitempty"`
+	Created    string   `json:"created"`
+	Expiration string   `json:"expiration"`
+	Viewed     string   `json:"viewed,omitempty"`
+}
+
+type filePayload struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	Size         int    `json:"size"`
+	Owner        string `json:"owner,omitempty"`
+	PassedAvScan bool   `json:"passedAvScan"`
+	Expiration   string `json:"expiration,omitempty"`
+}
+
+func newEventPayload(e filelocker.Event, includeBody bool) eventPayload {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		Logger.Println("unable to generate event id:", err)
+	}
+
+	p := eventPayload{
+		ID:        hex.EncodeToString(id),
+		Event:     e.Type,
+		Timestamp: e.Time,
+	}
+
+	if m := e.Message; m != nil {
+		data := messagePayload{
+			ID:         m.ID,
+			Sender:     m.OwnerID,
+			Recipients: m.Recipients,
+			Subject:    m.Subject,
+			Created:    m.Created,
+			Expiration: m.Expiration,
+			Viewed:     m.Viewed,
+		}
+		if includeBody {
+			data.Body = m.Body
+		}
+		p.Data = data
+	}
+
+	if f := e.File; f != nil {
+		p.Data = filePayload{
+			ID:           f.ID,
+			Name:         f.Name,
+			Size:         f.Size,
+			Owner:        f.OwnerID,
+			PassedAvScan: f.PassedAvScan,
+			Expiration:   f.Expiration,
+		}
+	}
+
+	return p
+}
+
+// dispatcher delivers signed event payloads to webhooks
+type dispatcher struct {
+	client  *http.Client
+	secret  []byte
+	retries int
+	backoff time.Duration
+}
+
+// deliverJitter randomly lengthens or shortens each retry delay by up to this fraction of it, so
+// that deliveries that failed together aren't retried together
+const deliverJitter = 0.2
+
+// deliver POSTs the body to the webhook, retrying network errors, server errors and rate limited
+// deliveries with exponential backoff
+func (d *dispatcher) deliver(ctx context.Context, hook, event string, body []byte) error {
+	delay := d.backoff
+
+	var err error
+	for attempt := 0; attempt <= d.retries; attempt++ {
+		if attempt > 0 {
+			wait := time.Duration(float64(delay) * (1 + deliverJitter*(2*mathrand.Float64()-1)))
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return errors.Wrapf(err, "gave up delivering %s to %s", event, hook)
+			}
+			delay *= 2
+		}
+
+		var retry bool
+		if retry, err = d.post(hook, event, body); err == nil {
+			return nil
+		} else if !retry {
+			break
+		}
+	}
+
+	return errors.Wrapf(err, "failed delivering %s to %s", event, hook)
+}
+
+// post POSTs the body to the webhook once and reports whether a failed delivery is worth retrying
+func (d *dispatcher) post(hook, event string, body []byte) (bool, error) {
+	req, err := http.NewRequest("POST", hook, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("User-Agent", fmt.Sprintf("go-filelocker/%s%s", Version, VersionPrerelease))
+	req.Header.Add("X-Filelocker-Event", event)
+	if len(d.secret) > 0 {
+		req.Header.Add("X-Filelocker-Signature", "sha256="+sign(d.secret, body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("non-success response from webhook: %s", resp.Status)
+	}
+
+	return false, nil
+}
+
+// sign returns the hex encoded HMAC-SHA256 of the body
+func sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	// RFC 4231 test case 2
+	expected := "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"
+	if sig := sign([]byte("Jefe"), []byte("what do ya want for nothing?")); sig != expected {
+		t.Errorf("expected signature %s, got %s", expected, sig)
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	body := []byte(`{"event":"message.received"}`)
+
+	var calls int
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+
+		if e := r.Header.Get("X-Filelocker-Event"); e != "message.received" {
+			t.Errorf("expected event header 'message.received', got %s", e)
+		}
+
+		if s := r.Header.Get("X-Filelocker-Signature"); s != "sha256="+sign([]byte("secret"), body) {
+			t.Errorf("unexpected signature header %s", s)
+		}
+
+		got, err := ioutil.ReadAll(r.Body)
+		if err != nil || string(got) != string(body) {
+			t.Errorf("expected body %s, got %s (%v)", body, got, err)
+		}
+
+		// fail the first two deliveries
+		if calls <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer hook.Close()
+
+	d := &dispatcher{client: hook.Client(), secret: []byte("secret"), retries: 2, backoff: time.Millisecond}
+	if err := d.deliver(context.Background(), hook.URL, "message.received", body); err != nil {
+		t.Error("expected delivery on the last retry, got", err)
+	}
+
+	if calls != 3 {
+		t.Errorf("expected 3 attempts, got %d", calls)
+	}
+
+	calls = 0
+	d.retries = 1
+	if err := d.deliver(context.Background(), hook.URL, "message.received", body); err == nil {
+		t.Error("expected error when the retries run out")
+	}
+
+	if calls != 2 {
+		t.Errorf("expected 2 attempts, got %d", calls)
+	}
+
+	// client errors aren't retried
+	var gone int
+	goneHook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gone++
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer goneHook.Close()
+
+	d.retries = 2
+	if err := d.deliver(context.Background(), goneHook.URL, "message.received", body); err == nil {
+		t.Error("expected error from a hook that's gone")
+	}
+
+	if gone != 1 {
+		t.Errorf("expected 1 attempt for a 410, got %d", gone)
+	}
+
+	// a cancelled context stops the retries
+	calls = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	d.backoff = time.Hour
+	if err := d.deliver(ctx, hook.URL, "message.received", body); err == nil {
+		t.Error("expected error when the context is cancelled")
+	}
+
+	if calls != 1 {
+		t.Errorf("expected 1 attempt before giving up, got %d", calls)
+	}
+}
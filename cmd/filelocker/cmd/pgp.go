@@ -0,0 +1,115 @@
+// Copyright © 2018 Yale University
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/YaleUniversity/go-filelocker/pkg/filelocker"
+
+	"github.com/pkg/errors"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+var pgpKeyrings []string
+var pgpSigner, pgpDomain string
+var pgpEncrypt, pgpSign bool
+
+func init() {
+	RootCmd.PersistentFlags().StringArrayVar(&pgpKeyrings, "pgp-keyring", []string{}, "OpenPGP keyring file(s) used to encrypt, decrypt, sign and verify message bodies")
+	sendCmd.Flags().BoolVar(&pgpEncrypt, "encrypt", false, "Encrypt the message body to the recipients' OpenPGP keys")
+	sendCmd.Flags().BoolVar(&pgpSign, "sign", false, "Sign the message body with OpenPGP")
+	sendCmd.Flags().StringVar(&pgpSigner, "pgp-signer", "", "The OpenPGP key (email or key id) to sign with, defaults to the first private key")
+	sendCmd.Flags().StringVar(&pgpDomain, "pgp-domain", "", "Find recipients' OpenPGP keys by their id at this email domain, ie. netid123@example.edu for example.edu")
+}
+
+// setupPGP configures end-to-end message protection on the client when keyrings are given.
+// The passphrase for encrypted private keys is read from FILELOCKER_PGP_PASSPHRASE or prompted for.
+func setupPGP() error {
+	if len(pgpKeyrings) == 0 {
+		if pgpEncrypt || pgpSign {
+			return errors.New("--pgp-keyring is required to encrypt or sign messages")
+		}
+		return nil
+	}
+
+	keyring, err := filelocker.LoadKeyring(pgpKeyrings...)
+	if err != nil {
+		return err
+	}
+
+	pgp := &filelocker.PGP{
+		Keyring:    keyring,
+		Domain:     pgpDomain,
+		Encrypt:    pgpEncrypt,
+		Passphrase: pgpPassphrase,
+	}
+
+	if pgpSign {
+		pgp.Signer, err = findSigner(keyring)
+		if err != nil {
+			return err
+		}
+	}
+
+	filelockerClient.PGP = pgp
+	return nil
+}
+
+func findSigner(keyring openpgp.EntityList) (*openpgp.Entity, error) {
+	if pgpSigner != "" {
+		e, err := filelocker.FindKey(keyring, pgpSigner)
+		if err != nil {
+			return nil, err
+		}
+
+		if e.PrivateKey == nil {
+			return nil, fmt.Errorf("no private key found for %s", pgpSigner)
+		}
+		return e, nil
+	}
+
+	for _, e := range keyring {
+		if e.PrivateKey != nil {
+			return e, nil
+		}
+	}
+
+	return nil, errors.New("no private key found to sign with")
+}
+
+func pgpPassphrase() ([]byte, error) {
+	if p, ok := os.LookupEnv("FILELOCKER_PGP_PASSPHRASE"); ok {
+		return []byte(p), nil
+	}
+
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, errors.New("private key is encrypted, set FILELOCKER_PGP_PASSPHRASE")
+	}
+
+	fmt.Fprint(os.Stderr, "OpenPGP passphrase: ")
+	pass, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	return pass, err
+}
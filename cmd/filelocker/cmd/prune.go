@@ -0,0 +1,247 @@
+// Copyright © 2018 Yale University
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/YaleUniversity/go-filelocker/pkg/filelocker"
+
+	"github.com/pkg/errors"
+
+	"github.com/spf13/cobra"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+var pruneOlderThan, pruneName, pruneLargerThan string
+var pruneTags []string
+var pruneFailedScan, pruneYes, pruneDryRun bool
+var pruneKeepNewest, pruneBatchSize int
+
+// pruneResult is the outcome of deleting a file
+type pruneResult struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Size     int    `json:"size"`
+	Uploaded string `json:"uploaded"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+}
+
+// filesPruneCmd represents the command to delete stale files
+var filesPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete your files that match a retention policy",
+	Long: `Delete your files that match all of the given selectors.  The files to delete are
+printed and confirmed before anything is deleted, unless --yes is given.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts := filelocker.PruneOptions{
+			Name:         pruneName,
+			FailedAvScan: pruneFailedScan,
+			KeepNewest:   pruneKeepNewest,
+		}
+		var err error
+
+		if pruneOlderThan != "" {
+			if opts.OlderThan, err = filelocker.ParseDuration(pruneOlderThan); err != nil {
+				return errors.Wrap(err, "invalid --older-than")
+			}
+		}
+
+		if pruneLargerThan != "" {
+			if opts.LargerThan, err = filelocker.ParseSize(pruneLargerThan); err != nil {
+				return errors.Wrap(err, "invalid --larger-than")
+			}
+		}
+
+		if opts.Tags, err = parseTags(pruneTags); err != nil {
+			return err
+		}
+
+		if pruneBatchSize < 1 {
+			return errors.New("batch size must be at least 1")
+		}
+
+		resp, err := filelockerClient.Files()
+		if err != nil {
+			return errors.Wrap(err, "unable to list files")
+		}
+
+		files, err := filelocker.PlanPrune(resp.Files, opts, time.Now().In(filelockerClient.DateLocation()))
+		if err != nil {
+			return err
+		}
+
+		results := []*pruneResult{}
+		for _, f := range files {
+			results = append(results, &pruneResult{ID: f.ID, Name: f.Name, Size: f.Size, Uploaded: f.Uploaded, Status: "would delete"})
+		}
+
+		if pruneDryRun || len(results) == 0 {
+			return pruneReport(results)
+		}
+
+		if !pruneYes {
+			if !asJSON {
+				for _, r := range results {
+					fmt.Printf("%s | %s | %d bytes | uploaded %s\n", r.ID, r.Name, r.Size, r.Uploaded)
+				}
+			}
+
+			ok, err := confirm(fmt.Sprintf("Delete %d files?", len(results)))
+			if err != nil {
+				return err
+			}
+
+			if !ok {
+				return errors.New("nothing deleted")
+			}
+		}
+
+		prune(results, pruneBatchSize)
+		return pruneReport(results)
+	},
+}
+
+func init() {
+	filesPruneCmd.Flags().StringVar(&pruneOlderThan, "older-than", "", "Delete files uploaded more than the duration ago (ie. 90d)")
+	filesPruneCmd.Flags().StringVar(&pruneName, "name", "", "Delete files with names matching the glob (ie. '*.tgz')")
+	filesPruneCmd.Flags().BoolVar(&pruneFailedScan, "failed-scan", false, "Delete files that failed their virus scan, not ones still being scanned")
+	filesPruneCmd.Flags().StringVar(&pruneLargerThan, "larger-than", "", "Delete files larger than the size (ie. 500MB)")
+	filesPruneCmd.Flags().StringArrayVar(&pruneTags, "tag", []string{}, "Delete files with the tag, as key=value")
+	filesPruneCmd.Flags().IntVar(&pruneKeepNewest, "keep-newest", 0, "Keep the newest N files with each name")
+	filesPruneCmd.Flags().IntVar(&pruneBatchSize, "batch-size", 20, "The number of files to delete per request")
+	filesPruneCmd.Flags().BoolVarP(&pruneYes, "yes", "y", false, "Delete without asking for confirmation")
+	filesPruneCmd.Flags().BoolVar(&pruneDryRun, "dry-run", false, "Print the files that would be deleted without deleting them")
+	filesCmd.AddCommand(filesPruneCmd)
+}
+
+// prune deletes the files in batches.  When a batch fails, files the server deleted before it
+// failed are found by listing the files again, and the rest are deleted one at a time, so each
+// file's result is known.
+func prune(results []*pruneResult, size int) {
+	for start := 0; start < len(results); start += size {
+		end := start + size
+		if end > len(results) {
+			end = len(results)
+		}
+		batch := results[start:end]
+
+		var ids []string
+		for _, r := range batch {
+			ids = append(ids, r.ID)
+		}
+
+		if _, err := filelockerClient.Delete(ids); err == nil {
+			for _, r := range batch {
+				r.Status = "deleted"
+			}
+			continue
+		}
+
+		remaining := remainingFiles()
+		for _, r := range batch {
+			if remaining != nil && !remaining[r.ID] {
+				r.Status = "deleted"
+				continue
+			}
+
+			if _, err := filelockerClient.Delete([]string{r.ID}); err != nil {
+				r.Status, r.Error = "failed", err.Error()
+				continue
+			}
+			r.Status = "deleted"
+		}
+	}
+}
+
+// remainingFiles returns the ids of the user's files, or nil if they can't be listed
+func remainingFiles() map[string]bool {
+	resp, err := filelockerClient.Files()
+	if err != nil {
+		return nil
+	}
+
+	ids := map[string]bool{}
+	for _, f := range resp.Files {
+		ids[f.ID] = true
+	}
+	return ids
+}
+
+// confirm asks a yes/no question on the terminal
+func confirm(question string) (bool, error) {
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return false, errors.New("not a terminal, use --yes to confirm")
+	}
+
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false, err
+	}
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+// pruneReport prints the result for each file and returns an error if any failed
+func pruneReport(results []*pruneResult) error {
+	var failed int
+	for _, r := range results {
+		if r.Error != "" {
+			failed++
+		}
+	}
+
+	if asJSON {
+		out, err := json.MarshalIndent(results, "", "    ")
+		if err != nil {
+			return errors.Wrap(err, "unable to marshal report into JSON")
+		}
+		fmt.Println(string(out))
+	} else {
+		if len(results) == 0 {
+			fmt.Println("No files to delete")
+		}
+
+		for _, r := range results {
+			if r.Error != "" {
+				fmt.Printf("%s | %s | %s: %s\n", r.ID, r.Name, r.Status, r.Error)
+				continue
+			}
+			fmt.Printf("%s | %s | %s\n", r.ID, r.Name, r.Status)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed to delete", failed, len(results))
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/YaleUniversity/go-filelocker/pkg/filelocker"
+)
+
+func TestPrunePartialBatch(t *testing.T) {
+	var mu sync.Mutex
+	stored := map[string]bool{"1": true, "2": true, "3": true, "9": true}
+	fl := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/xml")
+		switch r.URL.Path {
+		case "/cli/CLI_login":
+			w.Write([]byte(`<cli_response><messages><info>origin</info></messages></cli_response>`))
+		case "/file/delete_files":
+			ids := strings.Split(r.FormValue("fileIds"), ",")
+
+			// the batch fails after deleting its first file, file 3 can't be deleted and files
+			// that are already gone can't be deleted again
+			found := stored[ids[0]]
+			delete(stored, ids[0])
+			if len(ids) > 1 || ids[0] == "3" || !found {
+				w.Write([]byte(`<cli_response><messages><error>unable to delete file</error></messages></cli_response>`))
+				return
+			}
+			w.Write([]byte(`<cli_response><messages><info>deleted</info></messages></cli_response>`))
+		case "/file/get_user_file_list":
+			var files []string
+			for id := range stored {
+				files = append(files, fmt.Sprintf(`<file id="%s"/>`, id))
+			}
+			fmt.Fprintf(w, `<cli_response><messages/><data>%s</data></cli_response>`, strings.Join(files, ""))
+		default:
+			t.Errorf("unexpected url %s", r.URL)
+		}
+	}))
+	defer fl.Close()
+
+	client, err := filelocker.NewClient("user", "key", fl.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(c *filelocker.Client, j bool) { filelockerClient, asJSON = c, j }(filelockerClient, asJSON)
+	filelockerClient, asJSON = client, false
+
+	results := []*pruneResult{{ID: "1", Name: "a"}, {ID: "2", Name: "b"}, {ID: "3", Name: "c"}}
+
+	var reportErr error
+	out := captureStdout(t, func() {
+		prune(results, 3)
+		reportErr = pruneReport(results)
+	})
+
+	expected := "1 | a | deleted\n" +
+		"2 | b | deleted\n" +
+		"3 | c | failed: error deleting file\n"
+	if out != expected {
+		t.Errorf("expected report\n%s\ngot\n%s", expected, out)
+	}
+
+	if reportErr == nil || reportErr.Error() != "1 of 3 files failed to delete" {
+		t.Errorf("expected 1 of 3 failed, got %v", reportErr)
+	}
+}
@@ -23,6 +23,7 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/YaleUniversity/go-filelocker/pkg/filelocker"
 
@@ -63,7 +64,7 @@ var readCmd = &cobra.Command{
 		}
 
 		for _, m := range resp.Messages[0] {
-			fmt.Printf("ID: %d | Expiration: %s | Subject: %s | Body: %s\n", m.ID, m.Expiration, m.Subject, m.Body)
+			fmt.Printf("ID: %d | Expiration: %s | Subject: %s | Body: %s%s\n", m.ID, m.Expiration, m.Subject, m.Body, pgpSummary(m.PGP))
 		}
 		return nil
 	},
@@ -132,3 +133,25 @@ func messagesToJSON(resp *filelocker.SecureMessagesResponse) ([]byte, error) {
 
 	return out, nil
 }
+
+// pgpSummary describes how a message body was protected with OpenPGP
+func pgpSummary(s *filelocker.PGPStatus) string {
+	if s == nil {
+		return ""
+	}
+
+	var parts []string
+	if s.Encrypted {
+		parts = append(parts, "encrypted")
+	}
+
+	if s.Signed && s.Verified {
+		parts = append(parts, "signed by "+s.SignedBy)
+	}
+
+	if s.Error != "" {
+		parts = append(parts, "WARNING: "+s.Error)
+	}
+
+	return " | PGP: " + strings.Join(parts, ", ")
+}
@@ -0,0 +1,167 @@
+// Copyright © 2018 Yale University
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/YaleUniversity/go-filelocker/pkg/filelocker"
+
+	"github.com/pkg/errors"
+
+	"github.com/spf13/cobra"
+)
+
+var renewExpiringWithin, renewOlderThan, renewExtend string
+var renewTags []string
+var renewDryRun bool
+
+// renewResult is the outcome of renewing a file
+type renewResult struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// filesRenewCmd represents the command to extend the expiration of files
+var filesRenewCmd = &cobra.Command{
+	Use:   "renew",
+	Short: "Extend the expiration of your files that are expiring soon or were uploaded a while ago",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var opts filelocker.RenewOptions
+		var err error
+
+		if renewExpiringWithin != "" {
+			if opts.ExpiringWithin, err = filelocker.ParseDuration(renewExpiringWithin); err != nil {
+				return errors.Wrap(err, "invalid --expiring-within")
+			}
+		}
+
+		if renewOlderThan != "" {
+			if opts.OlderThan, err = filelocker.ParseDuration(renewOlderThan); err != nil {
+				return errors.Wrap(err, "invalid --older-than")
+			}
+		}
+
+		if opts.ExpiringWithin <= 0 && opts.OlderThan <= 0 {
+			return errors.New("--expiring-within or --older-than is required")
+		}
+
+		if renewExtend != "" {
+			if opts.Extend, err = filelocker.ParseDuration(renewExtend); err != nil {
+				return errors.Wrap(err, "invalid --extend")
+			}
+		}
+
+		if opts.Max, err = filelocker.ParseDuration(policyMaxExpiration); err != nil {
+			return errors.New("cannot parse max expiration")
+		}
+
+		if opts.Tags, err = parseTags(renewTags); err != nil {
+			return err
+		}
+
+		resp, err := filelockerClient.Files()
+		if err != nil {
+			return errors.Wrap(err, "unable to list files")
+		}
+
+		renewals, err := filelocker.PlanRenewals(resp.Files, opts, time.Now().In(filelockerClient.DateLocation()))
+		if err != nil {
+			return err
+		}
+
+		results := []*renewResult{}
+		for _, r := range renewals {
+			result := &renewResult{
+				ID:     r.File.ID,
+				Name:   r.File.Name,
+				From:   r.From.Format(filelocker.DateFormat),
+				To:     r.To.Format(filelocker.DateFormat),
+				Status: "would renew",
+			}
+			results = append(results, result)
+
+			if renewDryRun {
+				continue
+			}
+
+			if _, err := filelockerClient.UpdateFile(r.File.ID, filelocker.FileUpdate{Expiration: r.To}); err != nil {
+				result.Status, result.Error = "failed", err.Error()
+				continue
+			}
+			result.Status = "renewed"
+		}
+
+		return renewReport(results)
+	},
+}
+
+func init() {
+	filesRenewCmd.Flags().StringVar(&renewExpiringWithin, "expiring-within", "", "Renew files that expire within the duration (ie. 3d)")
+	filesRenewCmd.Flags().StringVar(&renewOlderThan, "older-than", "", "Renew files uploaded more than the duration ago (ie. 2w)")
+	filesRenewCmd.Flags().StringArrayVar(&renewTags, "tag", []string{}, "Only renew files with the tag, as key=value")
+	filesRenewCmd.Flags().StringVar(&renewExtend, "extend", "", "How far from now to move the expiration, defaults to --policy-max-expiration")
+	filesRenewCmd.Flags().BoolVar(&renewDryRun, "dry-run", false, "Print the files that would be renewed without renewing them")
+	filesCmd.AddCommand(filesRenewCmd)
+}
+
+// renewReport prints the result for each file and returns an error if any failed
+func renewReport(results []*renewResult) error {
+	var failed int
+	for _, r := range results {
+		if r.Error != "" {
+			failed++
+		}
+	}
+
+	if asJSON {
+		out, err := json.MarshalIndent(results, "", "    ")
+		if err != nil {
+			return errors.Wrap(err, "unable to marshal report into JSON")
+		}
+		fmt.Println(string(out))
+	} else {
+		if len(results) == 0 {
+			fmt.Println("No files to renew")
+		}
+
+		for _, r := range results {
+			if r.Error != "" {
+				fmt.Printf("%s | %s | %s -> %s | %s: %s\n", r.ID, r.Name, r.From, r.To, r.Status, r.Error)
+				continue
+			}
+			fmt.Printf("%s | %s | %s -> %s | %s\n", r.ID, r.Name, r.From, r.To, r.Status)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed to renew", failed, len(results))
+	}
+
+	return nil
+}
@@ -21,21 +21,32 @@
 package cmd
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/YaleUniversity/go-filelocker/pkg/filelocker"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
-var cfgFile, userID, apiKey, filelockerURL, clientTimeout string
+var cfgFile, profile, userID, apiKey, filelockerURL, clientTimeout, policyMaxExpiration string
 var filelockerClient *filelocker.Client
-var asJSON bool
+var asJSON, verbose, debug bool
+var retries int
+var retryBackoff string
+var retryMutating bool
+var clientRetry filelocker.RetryPolicy
+var rateLimit float64
+var rateBurst, maxInFlight int
 
 // Version is the main version number
 const Version = filelocker.Version
@@ -52,32 +63,124 @@ var RootCmd = &cobra.Command{
 	Short: "Filelocker 2 client.",
 	Long:  `A go cli for interacting with filelocker 2.`,
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := applyConfig(viper.GetViper(), cmd); err != nil {
+			return err
+		}
+
 		if filelockerURL == "" {
 			return errors.New("filelocker URL is required")
 		}
 
-		t, err := time.ParseDuration(clientTimeout)
+		t, err := parseTimeout(clientTimeout)
 		if err != nil {
-			return errors.New("cannot parse client timeout")
+			return err
+		}
+
+		if err := openTrace(); err != nil {
+			return err
+		}
+
+		if clientRetry, err = retryPolicy(); err != nil {
+			return err
+		}
+
+		if rateLimit < 0 || maxInFlight < 0 {
+			return errors.New("rate limit and max in-flight requests cannot be negative")
 		}
 
 		httpClient := &http.Client{
-			Timeout: t * time.Second,
+			Timeout: t,
 		}
 
-		filelockerClient, err = filelocker.NewClient(userID, apiKey, filelockerURL, httpClient)
-		return err
+		if useSessionCache {
+			if filelockerClient = resumeSession(filelockerURL, userID, httpClient); filelockerClient != nil {
+				return setupPGP()
+			}
+		}
+
+		creds, err := credentials()
+		if err != nil {
+			return err
+		}
+
+		filelockerClient, err = filelocker.New(filelockerURL, clientOptions(httpClient, filelocker.WithCredentialsProvider(creds))...)
+		if err != nil {
+			return err
+		}
+
+		if err := filelockerClient.Login(context.Background()); err != nil {
+			return err
+		}
+
+		if useSessionCache {
+			if err := saveSession(filelockerURL, userID, filelockerClient); err != nil {
+				Logger.Println("warning: unable to cache session:", err)
+			}
+		}
+
+		return setupPGP()
 	},
 }
 
+// clientOptions returns the options for filelocker clients created by the cli
+func clientOptions(httpClient *http.Client, opts ...filelocker.Option) []filelocker.Option {
+	options := []filelocker.Option{
+		filelocker.WithHTTPClient(httpClient),
+		filelocker.WithUserAgent("filelocker-cli/" + Version + VersionPrerelease),
+		filelocker.WithLogger(clientLogger()),
+		filelocker.WithTrace(traceOut),
+		filelocker.WithRetryPolicy(clientRetry),
+	}
+
+	if rateLimit > 0 {
+		options = append(options, filelocker.WithRateLimit(rateLimit, rateBurst))
+	}
+
+	if maxInFlight > 0 {
+		options = append(options, filelocker.WithMaxInFlight(maxInFlight))
+	}
+
+	return append(options, opts...)
+}
+
+// retryPolicy returns the retry policy for the --retries, --retry-backoff and --retry-mutating flags
+func retryPolicy() (filelocker.RetryPolicy, error) {
+	p := filelocker.DefaultRetryPolicy
+	if retries < 0 {
+		return p, errors.New("retries cannot be negative")
+	}
+
+	backoff, err := time.ParseDuration(retryBackoff)
+	if err != nil {
+		return p, fmt.Errorf("invalid retry backoff %q: %s", retryBackoff, err)
+	}
+
+	p.MaxAttempts = retries + 1
+	p.Backoff = backoff
+	p.RetryMutating = retryMutating
+	return p, nil
+}
+
 func init() {
 	cobra.OnInitialize(initConfig)
 	RootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "filelocker config file -- _not_ the control file (default is $HOME/.filelocker.yaml)")
+	RootCmd.PersistentFlags().StringVar(&profile, "profile", "", "The profile in the config file to use")
 	RootCmd.PersistentFlags().StringVarP(&userID, "login", "l", "", "The userid to use for connections to filelocker")
-	RootCmd.PersistentFlags().StringVarP(&clientTimeout, "timeout", "t", "30s", "The filelocker http client timeout (seconds)")
+	RootCmd.PersistentFlags().StringVarP(&clientTimeout, "timeout", "t", "30s", "The filelocker http client timeout (ie. 30s, 2m)")
 	RootCmd.PersistentFlags().StringVarP(&apiKey, "key", "k", "", "The api key to use for connections to filelocker")
 	RootCmd.PersistentFlags().StringVarP(&filelockerURL, "url", "u", "", "The base URL to use for connections to filelocker (ie. https://files.yale.edu")
 	RootCmd.PersistentFlags().BoolVarP(&asJSON, "json", "j", false, "Format the response as JSON where applicable")
+	RootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Log filelocker logins, retries and errors to STDERR")
+	RootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "Log every filelocker request and response to STDERR, with secrets redacted")
+	RootCmd.PersistentFlags().BoolVar(&trace, "trace", false, "Write each filelocker request and response to STDERR, with secrets redacted")
+	RootCmd.PersistentFlags().StringVar(&traceFile, "trace-file", "", "Append the trace of each filelocker request and response to a file")
+	RootCmd.PersistentFlags().IntVar(&retries, "retries", filelocker.DefaultRetryPolicy.MaxAttempts-1, "How many times to retry logins and read-only calls after network errors and 429, 502, 503 or 504 responses")
+	RootCmd.PersistentFlags().StringVar(&retryBackoff, "retry-backoff", filelocker.DefaultRetryPolicy.Backoff.String(), "The wait before the first retry, doubled for each retry after that")
+	RootCmd.PersistentFlags().BoolVar(&retryMutating, "retry-mutating", false, "Also retry calls that change something, like deletes and sent messages, which may then be applied twice")
+	RootCmd.PersistentFlags().Float64Var(&rateLimit, "rate-limit", 0, "The most filelocker requests to send a second on average, 0 for no limit")
+	RootCmd.PersistentFlags().IntVar(&rateBurst, "rate-burst", 1, "How many requests can be sent at once before --rate-limit applies")
+	RootCmd.PersistentFlags().IntVar(&maxInFlight, "max-in-flight", 0, "The most filelocker requests to have open at the same time, 0 for no limit")
+	RootCmd.PersistentFlags().StringVar(&policyMaxExpiration, "policy-max-expiration", "30d", "The longest expiration to allow when uploading, sending or renewing, a local policy that should be no longer than the filelocker server's limit")
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -89,8 +192,7 @@ func initConfig() {
 	viper.SetConfigName(".filelocker")     // name of config file (without extension)
 	viper.AddConfigPath(os.Getenv("HOME")) // adding home directory as first search path
 
-	viper.SetEnvPrefix("filelocker") // prefix environment variables with FILELOCKER
-	viper.AutomaticEnv()             // read in environment variables that match
+	bindEnv(viper.GetViper()) // read in environment variables that match
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
@@ -98,9 +200,113 @@ func initConfig() {
 	}
 }
 
+// bindEnv reads FILELOCKER_ prefixed environment variables, ie. send.wait-viewed is
+// FILELOCKER_SEND_WAIT_VIEWED
+func bindEnv(v *viper.Viper) {
+	v.SetEnvPrefix("filelocker")
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
+	v.AutomaticEnv()
+}
+
+// applyConfig sets the flags that weren't given on the command line from the environment or
+// config file, so the precedence is flag > env > config > default.  Global flags use their name as
+// the key, ie. url or FILELOCKER_URL, and command flags are namespaced by the command, ie.
+// files.upload.wait-scan or FILELOCKER_FILES_UPLOAD_WAIT_SCAN.
+func applyConfig(v *viper.Viper, cmd *cobra.Command) error {
+	if err := applyProfile(v, cmd); err != nil {
+		return err
+	}
+
+	prefix := strings.Join(strings.Fields(cmd.CommandPath())[1:], ".")
+
+	var err error
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if err != nil || f.Changed {
+			return
+		}
+
+		key := f.Name
+		if cmd.Root().PersistentFlags().Lookup(f.Name) == nil && prefix != "" {
+			key = prefix + "." + f.Name
+		}
+
+		// config files can use underscores instead of dashes, ie. key_command
+		if alt := strings.Replace(key, "-", "_", -1); !v.IsSet(key) && v.IsSet(alt) {
+			key = alt
+		}
+
+		if !v.IsSet(key) {
+			return
+		}
+
+		values := []string{v.GetString(key)}
+		if _, ok := v.Get(key).([]interface{}); ok {
+			values = v.GetStringSlice(key)
+		}
+
+		for _, value := range values {
+			if setErr := cmd.Flags().Set(f.Name, value); setErr != nil {
+				err = fmt.Errorf("invalid %s from config: %s", key, setErr)
+				return
+			}
+		}
+	})
+
+	return err
+}
+
+// parseTimeout parses the client timeout as a duration, or as seconds for compatibility
+func parseTimeout(s string) (time.Duration, error) {
+	if secs, err := strconv.Atoi(s); err == nil {
+		return time.Duration(secs) * time.Second, nil
+	}
+
+	t, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, errors.New("cannot parse client timeout")
+	}
+	return t, nil
+}
+
+// parseExpiration parses an expiration given as a duration from now or as an absolute date,
+// preferring the date, and validates it against --policy-max-expiration
+func parseExpiration(in, on string) (time.Time, error) {
+	limit, err := filelocker.ParseDuration(policyMaxExpiration)
+	if err != nil {
+		return time.Time{}, errors.New("cannot parse max expiration")
+	}
+
+	s := in
+	if on != "" {
+		s = on
+	}
+
+	now := time.Now()
+	expire, err := filelocker.ParseExpiration(s, now)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if err := filelocker.ValidateExpiration(expire, now, limit); err != nil {
+		return time.Time{}, err
+	}
+
+	return expire, nil
+}
+
+// exitError is an error that exits the cli with a specific status code
+type exitError struct {
+	error
+	code int
+}
+
+// Execute runs the root command and exits non-zero on error
 func Execute() {
 	if err := RootCmd.Execute(); err != nil {
 		Logger.Println(err)
+		if e, ok := err.(*exitError); ok {
+			os.Exit(e.code)
+		}
 		os.Exit(-1)
 	}
 }
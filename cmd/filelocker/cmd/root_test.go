@@ -0,0 +1,290 @@
+package cmd
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// newConfigTestCmd returns a root command with a global flag and a sub command with a local flag
+func newConfigTestCmd(url, user, wait *string, tags *[]string) (*cobra.Command, *cobra.Command) {
+	root := &cobra.Command{Use: "filelocker"}
+	root.PersistentFlags().StringVarP(url, "url", "u", "https://default.example.edu", "")
+	root.PersistentFlags().StringVarP(user, "login", "l", "", "")
+	root.PersistentFlags().String("profile", "", "")
+
+	files := &cobra.Command{Use: "files"}
+	upload := &cobra.Command{Use: "upload", Run: func(*cobra.Command, []string) {}}
+	upload.Flags().StringVar(wait, "wait-scan", "", "")
+	upload.Flags().StringArrayVar(tags, "encrypt-to", []string{}, "")
+
+	files.AddCommand(upload)
+	root.AddCommand(files)
+	return root, upload
+}
+
+func TestApplyConfigPrecedence(t *testing.T) {
+	config := `
+url: https://config.example.edu
+login: configuser
+files:
+  upload:
+    wait-scan: 5m
+    encrypt-to:
+      - age1one
+      - age1two
+`
+
+	tests := []struct {
+		args []string
+		env  map[string]string
+		url  string
+		user string
+		wait string
+		tags []string
+	}{
+		{
+			args: []string{"files", "upload"},
+			url:  "https://config.example.edu",
+			user: "configuser",
+			wait: "5m",
+			tags: []string{"age1one", "age1two"},
+		},
+		{
+			args: []string{"files", "upload"},
+			env:  map[string]string{"FILELOCKER_URL": "https://env.example.edu", "FILELOCKER_FILES_UPLOAD_WAIT_SCAN": "10m"},
+			url:  "https://env.example.edu",
+			user: "configuser",
+			wait: "10m",
+			tags: []string{"age1one", "age1two"},
+		},
+		{
+			args: []string{"files", "upload", "-u", "https://flag.example.edu", "--wait-scan", "1m", "--encrypt-to", "age1flag"},
+			env:  map[string]string{"FILELOCKER_URL": "https://env.example.edu"},
+			url:  "https://flag.example.edu",
+			user: "configuser",
+			wait: "1m",
+			tags: []string{"age1flag"},
+		},
+	}
+
+	for _, test := range tests {
+		for k, val := range test.env {
+			os.Setenv(k, val)
+		}
+
+		var url, user, wait string
+		var tags []string
+		root, upload := newConfigTestCmd(&url, &user, &wait, &tags)
+		root.SetArgs(test.args)
+		if err := root.Execute(); err != nil {
+			t.Fatal(err)
+		}
+
+		v := viper.New()
+		bindEnv(v)
+		v.SetConfigType("yaml")
+		if err := v.ReadConfig(strings.NewReader(config)); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := applyConfig(v, upload); err != nil {
+			t.Fatal(err)
+		}
+
+		if url != test.url || user != test.user || wait != test.wait || strings.Join(tags, ",") != strings.Join(test.tags, ",") {
+			t.Errorf("%v with env %v: expected url=%s login=%s wait-scan=%s encrypt-to=%v, got url=%s login=%s wait-scan=%s encrypt-to=%v",
+				test.args, test.env, test.url, test.user, test.wait, test.tags, url, user, wait, tags)
+		}
+
+		for k := range test.env {
+			os.Unsetenv(k)
+		}
+	}
+}
+
+func TestApplyConfigDefault(t *testing.T) {
+	var url, user, wait string
+	var tags []string
+	root, upload := newConfigTestCmd(&url, &user, &wait, &tags)
+	root.SetArgs([]string{"files", "upload"})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	v := viper.New()
+	bindEnv(v)
+	if err := applyConfig(v, upload); err != nil {
+		t.Fatal(err)
+	}
+
+	if url != "https://default.example.edu" || user != "" {
+		t.Errorf("expected defaults without config, got url=%s login=%s", url, user)
+	}
+}
+
+func TestParseTimeout(t *testing.T) {
+	tests := map[string]string{"30": "30s", "30s": "30s", "2m": "2m0s"}
+	for in, expected := range tests {
+		actual, err := parseTimeout(in)
+		if err != nil {
+			t.Errorf("error parsing timeout %s: %s", in, err)
+			continue
+		}
+
+		if actual.String() != expected {
+			t.Errorf("expected %s to parse as %s, got %s", in, expected, actual)
+		}
+	}
+}
+
+func TestApplyConfigProfile(t *testing.T) {
+	config := `
+url: https://files.example.edu
+login: toplevel
+profile: prod
+profiles:
+  prod:
+    login: svc-prod
+  staging:
+    url: https://staging.example.edu
+    login: svc-staging
+    files:
+      upload:
+        wait-scan: 1m
+`
+
+	tests := []struct {
+		args []string
+		env  map[string]string
+		url  string
+		user string
+		wait string
+	}{
+		{
+			args: []string{"files", "upload"},
+			url:  "https://files.example.edu",
+			user: "svc-prod",
+		},
+		{
+			args: []string{"files", "upload"},
+			env:  map[string]string{"FILELOCKER_PROFILE": "staging"},
+			url:  "https://staging.example.edu",
+			user: "svc-staging",
+			wait: "1m",
+		},
+		{
+			args: []string{"files", "upload", "--profile", "staging", "-l", "me"},
+			env:  map[string]string{"FILELOCKER_PROFILE": "prod"},
+			url:  "https://staging.example.edu",
+			user: "me",
+			wait: "1m",
+		},
+	}
+
+	for _, test := range tests {
+		for k, val := range test.env {
+			os.Setenv(k, val)
+		}
+
+		var url, user, wait string
+		var tags []string
+		root, upload := newConfigTestCmd(&url, &user, &wait, &tags)
+		root.SetArgs(test.args)
+		if err := root.Execute(); err != nil {
+			t.Fatal(err)
+		}
+
+		v := viper.New()
+		bindEnv(v)
+		v.SetConfigType("yaml")
+		if err := v.ReadConfig(strings.NewReader(config)); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := applyConfig(v, upload); err != nil {
+			t.Fatal(err)
+		}
+
+		if url != test.url || user != test.user || wait != test.wait {
+			t.Errorf("%v with env %v: expected url=%s login=%s wait-scan=%s, got url=%s login=%s wait-scan=%s",
+				test.args, test.env, test.url, test.user, test.wait, url, user, wait)
+		}
+
+		for k := range test.env {
+			os.Unsetenv(k)
+		}
+	}
+
+	var url, user, wait string
+	var tags []string
+	root, upload := newConfigTestCmd(&url, &user, &wait, &tags)
+	root.SetArgs([]string{"files", "upload", "--profile", "missing"})
+	if err := root.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(strings.NewReader(config)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := applyConfig(v, upload); err == nil {
+		t.Error("expected error for a missing profile, got nil")
+	}
+}
+
+func TestEventLogger(t *testing.T) {
+	var buf bytes.Buffer
+	defer func(l *log.Logger) { Logger = l }(Logger)
+	Logger = log.New(&buf, "", 0)
+
+	l := &eventLogger{level: levelInfo}
+	l.Debug("filelocker request", "path", "/cli/CLI_login")
+	l.Info("logged into filelocker", "user", "jdoe")
+	l.Warn("retrying filelocker request", "status", "502 Bad Gateway", "attempt")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines logged at info and above, got %q", buf.String())
+	}
+
+	if !strings.HasSuffix(lines[0], ` level=INFO msg="logged into filelocker" user=jdoe`) {
+		t.Errorf("unexpected info line %q", lines[0])
+	}
+
+	if !strings.HasSuffix(lines[1], ` level=WARN msg="retrying filelocker request" status="502 Bad Gateway" !BADKEY=attempt`) {
+		t.Errorf("unexpected warn line %q", lines[1])
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	defer func(r int, b string, m bool) { retries, retryBackoff, retryMutating = r, b, m }(retries, retryBackoff, retryMutating)
+
+	retries, retryBackoff, retryMutating = 4, "2s", true
+	p, err := retryPolicy()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.MaxAttempts != 5 || p.Backoff != 2*time.Second || !p.RetryMutating {
+		t.Errorf("unexpected retry policy %+v", p)
+	}
+
+	retries = 0
+	if p, err = retryPolicy(); err != nil || p.MaxAttempts != 1 {
+		t.Errorf("expected retries to be disabled, got %+v, %v", p, err)
+	}
+
+	retryBackoff = "soon"
+	if _, err := retryPolicy(); err == nil {
+		t.Error("expected error for an invalid backoff")
+	}
+}
@@ -21,6 +21,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -29,7 +30,7 @@ import (
 	"github.com/spf13/cobra"
 )
 
-var messageSubject, messageBody, expireIn string
+var messageSubject, messageBody, bodyFile, expireIn, expireOn, waitViewed, waitViewedInterval string
 var recipientList []string
 
 // sendCmd represents the command to send a message
@@ -37,11 +38,33 @@ var sendCmd = &cobra.Command{
 	Use:   "send",
 	Short: "Send a secure message",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		e, err := time.ParseDuration(expireIn)
+		if mergeFile != "" {
+			return runMerge()
+		}
+
+		if splitSpec != "" {
+			return runSplit(cmd)
+		}
+
+		expire, err := parseExpiration(expireIn, expireOn)
+		if err != nil {
+			return err
+		}
+
+		body, err := readMessageBody(cmd)
 		if err != nil {
-			return errors.Wrap(err, "unable to parse expiration")
+			return err
+		}
+
+		// the new message is told apart from earlier ones like it by the sent ids before sending
+		var sentBefore map[int]bool
+		if waitViewed != "" {
+			if sentBefore, err = sentMessageIDs(); err != nil {
+				return errors.Wrap(err, "unable to list sent secure messages")
+			}
 		}
-		resp, err := filelockerClient.NewSecureMessage(messageSubject, messageBody, recipientList, time.Now().Add(e))
+
+		resp, err := filelockerClient.NewSecureMessage(messageSubject, body, recipientList, expire)
 		if err != nil {
 			return errors.Wrap(err, "unable to send secure message")
 		}
@@ -59,6 +82,10 @@ var sendCmd = &cobra.Command{
 			return errors.Wrap(err, "error sending secure message")
 		}
 
+		if waitViewed != "" {
+			return waitForViewed(sentBefore)
+		}
+
 		return nil
 	},
 	TraverseChildren: true,
@@ -66,9 +93,49 @@ var sendCmd = &cobra.Command{
 
 func init() {
 	sendCmd.PersistentFlags().StringVarP(&messageSubject, "subject", "s", "Secure Mesaage", "The message subject")
-	sendCmd.PersistentFlags().StringVarP(&messageBody, "body", "b", "", "The message body")
-	sendCmd.PersistentFlags().StringVarP(&expireIn, "expireIn", "e", "720h", "The message expiration time from now (https://golang.org/pkg/time/#ParseDuration)")
-	// sendCmd.PersistentFlags().StringVarP(&expireOn, "expireOn", "o", "", "The message expiration date from ")
+	sendCmd.PersistentFlags().StringVarP(&messageBody, "body", "b", "", "The message body, or '-' to read it from stdin.  $EDITOR is opened when no body is given")
+	sendCmd.PersistentFlags().StringVar(&bodyFile, "body-file", "", "Read the message body from a file")
+	sendCmd.PersistentFlags().StringVarP(&expireIn, "expireIn", "e", "720h", "The message expiration time from now (ie. 36h, 5d, 2w)")
+	sendCmd.PersistentFlags().StringVarP(&expireOn, "expireOn", "o", "", "The message expiration date, overrides --expireIn (ie. 2026-12-31 or RFC3339)")
+	sendCmd.Flags().StringVar(&waitViewed, "wait-viewed", "", "Wait up to this long for the first recipient to view the message, exiting with status 2 if no one has")
+	sendCmd.Flags().StringVar(&waitViewedInterval, "wait-viewed-interval", "30s", "How often to check whether the message has been viewed")
+	sendCmd.Flags().StringVar(&mergeFile, "merge", "", "Send one message per row of a CSV file, rendering --template and --subject with the row's columns")
+	sendCmd.Flags().StringVar(&mergeTemplate, "template", "", "Go text/template file for the message body when using --merge")
+	sendCmd.Flags().StringVar(&mergeRecipientColumn, "recipient-column", "recipient", "The CSV column holding each message's recipient when using --merge")
+	sendCmd.Flags().BoolVar(&mergeDryRun, "dry-run", false, "Print the messages that would be sent by --merge without sending them")
+	sendCmd.Flags().IntVar(&mergeConcurrency, "concurrency", 4, "Number of messages to send at the same time when using --merge")
 	sendCmd.Flags().StringArrayVarP(&recipientList, "recipient", "r", []string{}, "Message recipient(s)")
 	RootCmd.AddCommand(sendCmd)
 }
+
+// waitForViewed blocks until the sent message has been viewed by its first recipient or the
+// --wait-viewed timeout elapses
+func waitForViewed(sentBefore map[int]bool) error {
+	timeout, err := time.ParseDuration(waitViewed)
+	if err != nil {
+		return errors.Wrap(err, "unable to parse wait viewed timeout")
+	}
+
+	interval, err := time.ParseDuration(waitViewedInterval)
+	if err != nil {
+		return errors.Wrap(err, "unable to parse wait viewed interval")
+	}
+
+	sent, err := findSentMessage(messageSubject, recipientList, sentBefore)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	m, err := filelockerClient.WaitForFirstView(ctx, sent.ID, interval)
+	if err == context.DeadlineExceeded {
+		return &exitError{fmt.Errorf("secure message %d was not viewed within %s", sent.ID, timeout), 2}
+	} else if err != nil {
+		return errors.Wrap(err, "unable to check if secure message was viewed")
+	}
+
+	printMessageStatus(m)
+	return nil
+}
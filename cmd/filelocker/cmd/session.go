@@ -0,0 +1,138 @@
+// Copyright © 2018 Yale University
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/YaleUniversity/go-filelocker/pkg/filelocker"
+
+	"github.com/pkg/errors"
+)
+
+var useSessionCache bool
+var sessionTTL string
+
+// cachedSession is a filelocker session saved between runs
+type cachedSession struct {
+	URL     string             `json:"url"`
+	UserID  string             `json:"userId"`
+	Created time.Time          `json:"created"`
+	Session filelocker.Session `json:"session"`
+}
+
+func init() {
+	RootCmd.PersistentFlags().BoolVar(&useSessionCache, "session-cache", false, "Reuse the filelocker session between runs instead of logging in every time")
+	RootCmd.PersistentFlags().StringVar(&sessionTTL, "session-ttl", "8h", "How long to reuse a cached session")
+}
+
+// sessionFile returns the cache file for the session of a user on a filelocker server
+func sessionFile(baseURL, user string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(baseURL + "\n" + user))
+	return filepath.Join(dir, "filelocker", "sessions", hex.EncodeToString(sum[:16])+".json"), nil
+}
+
+// resumeSession returns a client using the cached session, or nil if there's no usable session.
+// The session is checked with a request and removed from the cache when it's been rejected.
+func resumeSession(baseURL, user string, httpClient *http.Client) *filelocker.Client {
+	path, err := sessionFile(baseURL, user)
+	if err != nil {
+		return nil
+	}
+
+	ttl, err := time.ParseDuration(sessionTTL)
+	if err != nil {
+		Logger.Println("warning: cannot parse session ttl, logging in")
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	var cached cachedSession
+	if err := json.Unmarshal(data, &cached); err != nil || cached.URL != baseURL || cached.UserID != user || time.Since(cached.Created) > ttl {
+		os.Remove(path)
+		return nil
+	}
+
+	client, err := filelocker.New(baseURL, clientOptions(httpClient)...)
+	if err != nil {
+		return nil
+	}
+
+	if err := client.SetSession(cached.Session); err != nil {
+		return nil
+	}
+
+	if _, err := client.SecureMessagesCount(); err != nil {
+		os.Remove(path)
+		return nil
+	}
+
+	return client
+}
+
+// saveSession caches the client's session, readable only by the user since it's as good as the api key
+func saveSession(baseURL, user string, client *filelocker.Client) error {
+	path, err := sessionFile(baseURL, user)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return errors.Wrap(err, "unable to create session cache")
+	}
+
+	data, err := json.Marshal(cachedSession{URL: baseURL, UserID: user, Created: time.Now(), Session: client.Session()})
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".session-")
+	if err != nil {
+		return errors.Wrap(err, "unable to write session cache")
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrap(err, "unable to write session cache")
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
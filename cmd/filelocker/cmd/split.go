@@ -0,0 +1,249 @@
+// Copyright © 2018 Yale University
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/YaleUniversity/go-filelocker/pkg/shamir"
+
+	"github.com/pkg/errors"
+
+	"github.com/spf13/cobra"
+)
+
+var splitSpec string
+
+// shareFormat matches an encoded share, ie. filelocker-share:v1:<set id>:<k>:<n>:<base64 share>
+var shareFormat = regexp.MustCompile(`filelocker-share:v1:([0-9a-f]+):([0-9]+):([0-9]+):([A-Za-z0-9+/=]+)`)
+
+// share is one part of a secret split with shamir's secret sharing
+type share struct {
+	set  string
+	k, n int
+	data []byte
+}
+
+func (s share) String() string {
+	return fmt.Sprintf("filelocker-share:v1:%s:%d:%d:%s", s.set, s.k, s.n, base64.StdEncoding.EncodeToString(s.data))
+}
+
+// parseShares finds all of the encoded shares in a string
+func parseShares(s string) ([]share, error) {
+	var shares []share
+	for _, m := range shareFormat.FindAllStringSubmatch(s, -1) {
+		k, _ := strconv.Atoi(m[2])
+		n, _ := strconv.Atoi(m[3])
+		data, err := base64.StdEncoding.DecodeString(m[4])
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid share")
+		}
+		shares = append(shares, share{set: m[1], k: k, n: n, data: data})
+	}
+	return shares, nil
+}
+
+// parseSplit parses a k-of-n split specification
+func parseSplit(spec string) (int, int, error) {
+	parts := strings.Split(spec, "-of-")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid split %q, expected k-of-n (ie. 2-of-3)", spec)
+	}
+
+	k, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid split %q, expected k-of-n (ie. 2-of-3)", spec)
+	}
+
+	n, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid split %q, expected k-of-n (ie. 2-of-3)", spec)
+	}
+
+	return k, n, nil
+}
+
+// runSplit splits the message body into one share per recipient and sends each share as
+// its own secure message
+func runSplit(cmd *cobra.Command) error {
+	k, n, err := parseSplit(splitSpec)
+	if err != nil {
+		return err
+	}
+
+	if len(recipientList) != n {
+		return fmt.Errorf("splitting %s needs exactly %d recipients, got %d", splitSpec, n, len(recipientList))
+	}
+
+	expire, err := parseExpiration(expireIn, expireOn)
+	if err != nil {
+		return err
+	}
+
+	body, err := readMessageBody(cmd)
+	if err != nil {
+		return err
+	}
+
+	parts, err := shamir.Split([]byte(body), n, k)
+	if err != nil {
+		return errors.Wrap(err, "unable to split message body")
+	}
+
+	set := make([]byte, 4)
+	if _, err := rand.Read(set); err != nil {
+		return errors.Wrap(err, "unable to generate share set id")
+	}
+
+	var failed int
+	for i, r := range recipientList {
+		s := share{set: hex.EncodeToString(set), k: k, n: n, data: parts[i]}
+		subject := fmt.Sprintf("%s (share %d of %d)", messageSubject, i+1, n)
+		msg := fmt.Sprintf("This is one of %d shares of a secret, %d of which are needed to recover it with 'filelocker messages combine'.\n\n%s\n", n, k, s)
+
+		if _, err := filelockerClient.NewSecureMessage(subject, msg, []string{r}, expire); err != nil {
+			Logger.Printf("unable to send share %d to %s: %s", i+1, r, err)
+			failed++
+			continue
+		}
+		fmt.Printf("Sent share %d of %d to %s\n", i+1, n, r)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d shares failed to send", failed, n)
+	}
+
+	return nil
+}
+
+// messagesCombineCmd represents the command to recover a secret from its shares
+var messagesCombineCmd = &cobra.Command{
+	Use:   "combine [message id | share]...",
+	Short: "Recover a secret sent with 'send --split'",
+	Long: `Recovers a secret split with 'send --split' from its shares.  Shares are given as the ids of
+messages containing them or pasted as arguments.  When no arguments are given, shares are read
+from stdin.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var shares []share
+		var ids []int
+		for _, a := range args {
+			if id, err := strconv.Atoi(a); err == nil {
+				ids = append(ids, id)
+				continue
+			}
+
+			s, err := parseShares(a)
+			if err != nil {
+				return err
+			}
+			if len(s) == 0 {
+				return fmt.Errorf("%q is not a message id or share", a)
+			}
+			shares = append(shares, s...)
+		}
+
+		if len(ids) > 0 {
+			resp, err := filelockerClient.SecureMessages()
+			if err != nil {
+				return errors.Wrap(err, "unable to read secure messages")
+			}
+
+			for _, id := range ids {
+				m, ok := resp.Message(id)
+				if !ok {
+					return fmt.Errorf("secure message %d not found", id)
+				}
+
+				s, err := parseShares(m.Body)
+				if err != nil {
+					return err
+				}
+				if len(s) == 0 {
+					return fmt.Errorf("secure message %d doesn't contain a share", id)
+				}
+				shares = append(shares, s...)
+			}
+		}
+
+		if len(args) == 0 {
+			scanner := bufio.NewScanner(os.Stdin)
+			for scanner.Scan() {
+				s, err := parseShares(scanner.Text())
+				if err != nil {
+					return err
+				}
+				shares = append(shares, s...)
+			}
+			if err := scanner.Err(); err != nil {
+				return errors.Wrap(err, "unable to read shares")
+			}
+		}
+
+		secret, err := combineShares(shares)
+		if err != nil {
+			return err
+		}
+
+		fmt.Print(string(secret))
+		if !strings.HasSuffix(string(secret), "\n") {
+			fmt.Println()
+		}
+		return nil
+	},
+}
+
+func combineShares(shares []share) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, errors.New("no shares given")
+	}
+
+	var parts [][]byte
+	for _, s := range shares {
+		if s.set != shares[0].set {
+			return nil, errors.New("shares are from different secrets")
+		}
+		parts = append(parts, s.data)
+	}
+
+	if len(parts) < shares[0].k {
+		return nil, fmt.Errorf("%d shares are needed to recover the secret, got %d", shares[0].k, len(parts))
+	}
+
+	secret, err := shamir.Combine(parts)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to combine shares")
+	}
+
+	return secret, nil
+}
+
+func init() {
+	sendCmd.Flags().StringVar(&splitSpec, "split", "", "Split the body into one share per recipient, any k of which recover it (ie. 2-of-3)")
+	messagesCmd.AddCommand(messagesCombineCmd)
+}
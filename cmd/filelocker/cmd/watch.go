@@ -0,0 +1,216 @@
+// Copyright © 2018 Yale University
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/YaleUniversity/go-filelocker/pkg/filelocker"
+
+	"github.com/pkg/errors"
+
+	"github.com/spf13/cobra"
+)
+
+var watchInterval, watchExec, watchRetryDelay string
+var watchConcurrency, watchRetries int
+var watchBackfill bool
+
+// watchCmd represents the command to watch for new messages and shared files
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Watch for new secure messages and shared files",
+	Long: `Polls filelocker for new secure messages and newly shared files.
+
+When --exec is given, the command is run with 'sh -c' for each event.  The event metadata is
+passed in the environment (FILELOCKER_EVENT, FILELOCKER_ID, FILELOCKER_SENDER, FILELOCKER_SUBJECT,
+FILELOCKER_FILE_NAME and FILELOCKER_FILE_SIZE) and the message body is written to stdin.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		interval, err := time.ParseDuration(watchInterval)
+		if err != nil {
+			return errors.Wrap(err, "unable to parse interval")
+		}
+
+		retryDelay, err := time.ParseDuration(watchRetryDelay)
+		if err != nil {
+			return errors.Wrap(err, "unable to parse retry delay")
+		}
+
+		if watchConcurrency < 1 {
+			return errors.New("concurrency must be at least 1")
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(sigs)
+		go func() {
+			select {
+			case <-sigs:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		watcher := &filelocker.Watcher{
+			Client:   filelockerClient,
+			Interval: interval,
+			Backfill: watchBackfill,
+			OnError: func(err error) {
+				Logger.Println("error polling filelocker:", err)
+			},
+		}
+
+		events := make(chan filelocker.Event)
+		var wg sync.WaitGroup
+		for i := 0; i < watchConcurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for e := range events {
+					if watchExec == "" {
+						printEvent(e)
+						continue
+					}
+
+					if err := runHook(ctx, e, retryDelay); err != nil {
+						Logger.Println(err)
+					}
+				}
+			}()
+		}
+
+		err = watcher.Watch(ctx, events)
+		close(events)
+		wg.Wait()
+
+		if err == context.Canceled {
+			return nil
+		}
+		return err
+	},
+	TraverseChildren: true,
+}
+
+func init() {
+	watchCmd.Flags().StringVarP(&watchInterval, "interval", "i", "1m", "How often to poll filelocker")
+	watchCmd.Flags().StringVarP(&watchExec, "exec", "x", "", "Command to run for each new message or shared file")
+	watchCmd.Flags().IntVarP(&watchConcurrency, "concurrency", "c", 1, "Number of commands to run at the same time")
+	watchCmd.Flags().IntVar(&watchRetries, "retries", 0, "Number of times to retry a failed command")
+	watchCmd.Flags().StringVar(&watchRetryDelay, "retry-delay", "10s", "How long to wait before retrying a failed command")
+	watchCmd.Flags().BoolVar(&watchBackfill, "backfill", false, "Also report messages and files that exist when watching starts")
+	RootCmd.AddCommand(watchCmd)
+}
+
+// runHook runs the exec command for an event, retrying on failure
+func runHook(ctx context.Context, e filelocker.Event, retryDelay time.Duration) error {
+	var err error
+	for attempt := 0; attempt <= watchRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(retryDelay):
+			case <-ctx.Done():
+				return err
+			}
+		}
+
+		// the hook is not tied to ctx so an interrupt doesn't kill a running command
+		c := exec.Command("sh", "-c", watchExec)
+		c.Env = append(os.Environ(), eventEnv(e)...)
+		c.Stdout = os.Stdout
+		c.Stderr = os.Stderr
+		if e.Message != nil {
+			c.Stdin = bytes.NewBufferString(e.Message.Body)
+		}
+
+		if err = c.Run(); err == nil {
+			return nil
+		}
+	}
+
+	return errors.Wrapf(err, "command failed for %s event %s", e.Type, eventID(e))
+}
+
+// eventEnv returns the environment variables describing an event
+func eventEnv(e filelocker.Event) []string {
+	env := []string{
+		"FILELOCKER_EVENT=" + e.Type,
+		"FILELOCKER_ID=" + eventID(e),
+	}
+
+	if e.Message != nil {
+		env = append(env,
+			"FILELOCKER_SENDER="+e.Message.OwnerID,
+			"FILELOCKER_SUBJECT="+e.Message.Subject,
+		)
+	}
+
+	if e.File != nil {
+		env = append(env,
+			"FILELOCKER_SENDER="+e.File.OwnerID,
+			"FILELOCKER_FILE_NAME="+e.File.Name,
+			"FILELOCKER_FILE_SIZE="+strconv.Itoa(e.File.Size),
+		)
+	}
+
+	return env
+}
+
+func eventID(e filelocker.Event) string {
+	switch {
+	case e.Message != nil:
+		return strconv.Itoa(e.Message.ID)
+	case e.File != nil:
+		return e.File.ID
+	}
+	return ""
+}
+
+func printEvent(e filelocker.Event) {
+	if asJSON {
+		out, err := json.Marshal(e)
+		if err != nil {
+			Logger.Println("unable to marshal event into JSON:", err)
+			return
+		}
+		fmt.Println(string(out))
+		return
+	}
+
+	switch {
+	case e.Message != nil:
+		fmt.Printf("%s | ID: %d | From: %s | Subject: %s\n", e.Type, e.Message.ID, e.Message.OwnerID, e.Message.Subject)
+	case e.File != nil:
+		fmt.Printf("%s | ID: %s | From: %s | Name: %s\n", e.Type, e.File.ID, e.File.OwnerID, e.File.Name)
+	}
+}
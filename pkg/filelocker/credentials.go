@@ -0,0 +1,175 @@
+package filelocker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// CredentialsProvider provides the user id and api key used to log in to filelocker
+type CredentialsProvider interface {
+	Credentials(ctx context.Context) (userID, apiKey string, err error)
+}
+
+// StaticCredentials are a fixed user id and api key
+type StaticCredentials struct {
+	UserID string
+	APIKey string
+}
+
+// Credentials returns the user id and api key
+func (c StaticCredentials) Credentials(ctx context.Context) (string, string, error) {
+	if c.APIKey == "" {
+		return "", "", errors.New("no api key")
+	}
+	return c.UserID, c.APIKey, nil
+}
+
+// KeyFileCredentials reads the api key from a file, refusing files other users can access
+type KeyFileCredentials struct {
+	UserID string
+	Path   string
+}
+
+// Credentials returns the user id and the api key read from the file
+func (c KeyFileCredentials) Credentials(ctx context.Context) (string, string, error) {
+	path := os.ExpandEnv(c.Path)
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", "", err
+	}
+
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0007 != 0 {
+		return "", "", fmt.Errorf("key file %s is accessible by other users (%s), chmod 600 it", path, info.Mode().Perm())
+	}
+
+	key, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", "", err
+	}
+
+	return trimKey(c.UserID, key, "key file "+path)
+}
+
+// CommandCredentials runs a command, like a password manager, that prints the api key
+type CommandCredentials struct {
+	UserID string
+
+	// Command is run with sh -c
+	Command string
+}
+
+// Credentials returns the user id and the api key printed by the command
+func (c CommandCredentials) Credentials(ctx context.Context) (string, string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", c.Command)
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", "", fmt.Errorf("key command failed: %s %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return trimKey(c.UserID, out, "key command")
+}
+
+// KeyringCredentials looks up the api key in the OS keyring: the secret service (over D-Bus, with
+// secret-tool) on linux and the keychain on macOS.  The key is stored with the Service and the
+// user id, ie.
+//
+//	secret-tool store --label filelocker service filelocker user mynetid
+//	security add-generic-password -s filelocker -a mynetid -w
+type KeyringCredentials struct {
+	UserID string
+
+	// Service names the key in the keyring, defaults to "filelocker"
+	Service string
+}
+
+// Credentials returns the user id and the api key from the keyring
+func (c KeyringCredentials) Credentials(ctx context.Context) (string, string, error) {
+	service := c.Service
+	if service == "" {
+		service = "filelocker"
+	}
+
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.CommandContext(ctx, "security", "find-generic-password", "-s", service, "-a", c.UserID, "-w")
+	case "linux", "freebsd", "openbsd", "netbsd":
+		cmd = exec.CommandContext(ctx, "secret-tool", "lookup", "service", service, "user", c.UserID)
+	default:
+		return "", "", fmt.Errorf("no keyring support on %s", runtime.GOOS)
+	}
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", "", fmt.Errorf("unable to find the api key for %s in the keyring: %s", c.UserID, err)
+	}
+
+	return trimKey(c.UserID, out, "keyring")
+}
+
+// EncryptedFileCredentials reads the api key from a file encrypted with an age passphrase, ie.
+//
+//	age -p -o ~/.filelocker.key.age
+type EncryptedFileCredentials struct {
+	UserID string
+	Path   string
+
+	// Passphrase is called to get the passphrase the file is encrypted with
+	Passphrase func() ([]byte, error)
+}
+
+// Credentials returns the user id and the api key decrypted from the file
+func (c EncryptedFileCredentials) Credentials(ctx context.Context) (string, string, error) {
+	if c.Passphrase == nil {
+		return "", "", errors.New("no passphrase for the encrypted key file")
+	}
+
+	f, err := os.Open(os.ExpandEnv(c.Path))
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+
+	pass, err := c.Passphrase()
+	if err != nil {
+		return "", "", err
+	}
+
+	identity, err := age.NewScryptIdentity(string(pass))
+	if err != nil {
+		return "", "", err
+	}
+
+	r, err := age.Decrypt(f, identity)
+	if err != nil {
+		return "", "", fmt.Errorf("unable to decrypt key file: %s", err)
+	}
+
+	key, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", "", err
+	}
+
+	return trimKey(c.UserID, key, "encrypted key file")
+}
+
+// trimKey trims the whitespace around a key, returning an error if it's empty
+func trimKey(userID string, key []byte, source string) (string, string, error) {
+	k := strings.TrimSpace(string(key))
+	if k == "" {
+		return "", "", fmt.Errorf("no api key in %s", source)
+	}
+	return userID, k, nil
+}
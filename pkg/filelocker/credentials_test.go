@@ -0,0 +1,111 @@
+package filelocker_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+
+	"github.com/YaleUniversity/go-filelocker/pkg/filelocker"
+)
+
+func TestKeyFileCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filelocker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "key")
+	if err := ioutil.WriteFile(path, []byte("xxxxxyyyyyy\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	creds := filelocker.KeyFileCredentials{UserID: "testuser", Path: path}
+	user, key, err := creds.Credentials(context.Background())
+	if err != nil {
+		t.Fatal("error reading key file", err)
+	}
+
+	if user != "testuser" || key != "xxxxxyyyyyy" {
+		t.Errorf("expected testuser and xxxxxyyyyyy, got %s and %s", user, key)
+	}
+
+	if err := os.Chmod(path, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := creds.Credentials(context.Background()); err == nil {
+		t.Error("expected error reading a world readable key file, got nil")
+	}
+}
+
+func TestCommandCredentials(t *testing.T) {
+	creds := filelocker.CommandCredentials{UserID: "testuser", Command: "echo '  xxxxxyyyyyy  '"}
+	_, key, err := creds.Credentials(context.Background())
+	if err != nil {
+		t.Fatal("error running key command", err)
+	}
+
+	if key != "xxxxxyyyyyy" {
+		t.Errorf("expected xxxxxyyyyyy, got %q", key)
+	}
+
+	for _, command := range []string{"exit 1", "true"} {
+		creds.Command = command
+		if _, _, err := creds.Credentials(context.Background()); err == nil {
+			t.Errorf("expected error from key command %q, got nil", command)
+		}
+	}
+}
+
+func TestEncryptedFileCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filelocker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	recipient, err := age.NewScryptRecipient("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient.SetWorkFactor(10)
+
+	path := filepath.Join(dir, "key.age")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := age.Encrypt(f, recipient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("xxxxxyyyyyy\n"))
+	w.Close()
+	f.Close()
+
+	creds := filelocker.EncryptedFileCredentials{
+		UserID:     "testuser",
+		Path:       path,
+		Passphrase: func() ([]byte, error) { return []byte("correct horse battery staple"), nil },
+	}
+
+	_, key, err := creds.Credentials(context.Background())
+	if err != nil {
+		t.Fatal("error decrypting key file", err)
+	}
+
+	if key != "xxxxxyyyyyy" {
+		t.Errorf("expected xxxxxyyyyyy, got %q", key)
+	}
+
+	creds.Passphrase = func() ([]byte, error) { return []byte("wrong"), nil }
+	if _, _, err := creds.Credentials(context.Background()); err == nil {
+		t.Error("expected error decrypting with the wrong passphrase, got nil")
+	}
+}
@@ -0,0 +1,60 @@
+package filelocker
+
+import (
+	"bufio"
+	"io"
+
+	"filippo.io/age"
+)
+
+// ageHeader starts every file encrypted with age
+const ageHeader = "age-encryption.org/v1"
+
+// FileEncryption configures client-side encryption of files with age (https://age-encryption.org),
+// so their contents are never visible to the filelocker server.  Uploads are encrypted to the
+// Recipients, either X25519 public keys or a passphrase, and downloads that start with the age
+// header are decrypted with the Identities.  Files can also be decrypted with the age cli.
+type FileEncryption struct {
+	Recipients []age.Recipient
+	Identities []age.Identity
+}
+
+// encrypt reads a file and writes it to dst encrypted to the recipients
+func (e *FileEncryption) encrypt(dst io.Writer, f io.Reader) error {
+	w, err := age.Encrypt(dst, e.Recipients...)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(w, f); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
+
+// decrypt returns a reader of the decrypted file when it is encrypted with age and identities
+// are available, otherwise the file is returned unchanged.  It reports whether the file is
+// encrypted and whether it was decrypted.
+func (e *FileEncryption) decrypt(f io.Reader) (io.Reader, bool, bool, error) {
+	br := bufio.NewReader(f)
+	header, err := br.Peek(len(ageHeader))
+	if err != nil && err != io.EOF {
+		return nil, false, false, err
+	}
+
+	if string(header) != ageHeader {
+		return br, false, false, nil
+	}
+
+	if e == nil || len(e.Identities) == 0 {
+		return br, true, false, nil
+	}
+
+	r, err := age.Decrypt(br, e.Identities...)
+	if err != nil {
+		return nil, true, false, err
+	}
+
+	return r, true, true, nil
+}
@@ -0,0 +1,100 @@
+package filelocker
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	day  = 24 * time.Hour
+	week = 7 * day
+)
+
+var durationPart = regexp.MustCompile(`^([0-9]*\.?[0-9]+)([a-zµμ]+)`)
+
+// dateLayouts are the absolute expiration formats accepted by ParseExpiration
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+	DateFormat,
+}
+
+// ParseDuration parses a duration like time.ParseDuration, but also accepts
+// day (d) and week (w) units, ie. "5d", "2w" or "1w2d12h".
+func ParseDuration(s string) (time.Duration, error) {
+	in := strings.TrimSpace(s)
+	if in == "" {
+		return 0, errors.New("empty duration")
+	}
+
+	var total time.Duration
+	for in != "" {
+		m := durationPart.FindStringSubmatch(in)
+		if m == nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		in = in[len(m[0]):]
+
+		var unit time.Duration
+		switch m[2] {
+		case "d":
+			unit = day
+		case "w":
+			unit = week
+		default:
+			d, err := time.ParseDuration(m[0])
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q", s)
+			}
+			total += d
+			continue
+		}
+
+		n, err := strconv.ParseFloat(m[1], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		total += time.Duration(n * float64(unit))
+	}
+
+	return total, nil
+}
+
+// ParseExpiration parses an expiration given either as a duration from now (see
+// ParseDuration) or as an absolute date, ie. "2026-12-31", "12/31/2026" or an RFC3339
+// timestamp.  Dates without a zone are in local time.
+func ParseExpiration(s string, now time.Time) (time.Time, error) {
+	in := strings.TrimSpace(s)
+
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, in, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	d, err := ParseDuration(in)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid expiration %q, expected a duration (ie. 5d, 2w, 36h) or a date (ie. 2026-12-31)", s)
+	}
+
+	return now.Add(d), nil
+}
+
+// ValidateExpiration checks that an expiration is after now and no later than limit from
+// now.  A limit of zero disables the upper bound.
+func ValidateExpiration(expire, now time.Time, limit time.Duration) error {
+	if !expire.After(now) {
+		return fmt.Errorf("expiration %s is in the past", expire.Format(DateFormat))
+	}
+
+	if limit > 0 && expire.After(now.Add(limit)) {
+		return fmt.Errorf("expiration %s is later than the maximum of %s", expire.Format(DateFormat), now.Add(limit).Format(DateFormat))
+	}
+
+	return nil
+}
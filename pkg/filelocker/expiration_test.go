@@ -0,0 +1,85 @@
+package filelocker_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/YaleUniversity/go-filelocker/pkg/filelocker"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := map[string]time.Duration{
+		"720h":    720 * time.Hour,
+		"5d":      5 * 24 * time.Hour,
+		"2w":      14 * 24 * time.Hour,
+		"1w2d12h": 9*24*time.Hour + 12*time.Hour,
+		"1.5d":    36 * time.Hour,
+		"90m":     90 * time.Minute,
+	}
+
+	for in, expected := range tests {
+		actual, err := filelocker.ParseDuration(in)
+		if err != nil {
+			t.Errorf("error parsing duration %s: %s", in, err)
+			continue
+		}
+
+		if actual != expected {
+			t.Errorf("expected %s to parse as %s, got %s", in, expected, actual)
+		}
+	}
+
+	for _, in := range []string{"", "5", "d", "5x", "5d-"} {
+		if _, err := filelocker.ParseDuration(in); err == nil {
+			t.Errorf("expected error parsing duration %q, got nil", in)
+		}
+	}
+}
+
+func TestParseExpiration(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.Local)
+
+	tests := map[string]time.Time{
+		"5d":                   now.Add(5 * 24 * time.Hour),
+		"2026-12-31":           time.Date(2026, 12, 31, 0, 0, 0, 0, time.Local),
+		"12/31/2026":           time.Date(2026, 12, 31, 0, 0, 0, 0, time.Local),
+		"2026-12-31T08:00:00Z": time.Date(2026, 12, 31, 8, 0, 0, 0, time.UTC),
+	}
+
+	for in, expected := range tests {
+		actual, err := filelocker.ParseExpiration(in, now)
+		if err != nil {
+			t.Errorf("error parsing expiration %s: %s", in, err)
+			continue
+		}
+
+		if !actual.Equal(expected) {
+			t.Errorf("expected %s to parse as %s, got %s", in, expected, actual)
+		}
+	}
+
+	if _, err := filelocker.ParseExpiration("next tuesday", now); err == nil {
+		t.Error("expected error parsing expiration 'next tuesday', got nil")
+	}
+}
+
+func TestValidateExpiration(t *testing.T) {
+	now := time.Now()
+	limit := 30 * 24 * time.Hour
+
+	if err := filelocker.ValidateExpiration(now.Add(24*time.Hour), now, limit); err != nil {
+		t.Error("expected expiration tomorrow to be valid, got", err)
+	}
+
+	if err := filelocker.ValidateExpiration(now.Add(-24*time.Hour), now, limit); err == nil {
+		t.Error("expected error for expiration in the past, got nil")
+	}
+
+	if err := filelocker.ValidateExpiration(now.Add(60*24*time.Hour), now, limit); err == nil {
+		t.Error("expected error for expiration after the maximum, got nil")
+	}
+
+	if err := filelocker.ValidateExpiration(now.Add(60*24*time.Hour), now, 0); err != nil {
+		t.Error("expected no maximum when limit is zero, got", err)
+	}
+}
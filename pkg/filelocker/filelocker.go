@@ -1,6 +1,7 @@
 package filelocker
 
 import (
+	"context"
 	"encoding/xml"
 	"errors"
 	"fmt"
@@ -9,6 +10,7 @@ import (
 	"net/http/cookiejar"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -19,67 +21,166 @@ type Client struct {
 	Errors   []string
 	Messages []string
 	Origin   string
+
+	// PGP enables end-to-end OpenPGP protection of secure message bodies when set
+	PGP *PGP
+
+	// FileEncryption enables client-side encryption of uploaded and downloaded files when set
+	FileEncryption *FileEncryption
+
+	credentials CredentialsProvider
+	userAgent   string
+	logger      Logger
+	retry       RetryPolicy
+	location    *time.Location
+	trace       *tracer
+	limiter     *rateLimiter
+	inFlight    chan struct{}
+	mu          sync.Mutex
 }
 
 const (
 	defaultAcceptHeader      = "text/xml"
 	defaultContentTypeHeader = "application/x-www-form-urlencoded"
+
+	// DateFormat is the layout filelocker uses for dates
+	DateFormat = "01/02/2006"
 )
 
-// NewClient returns a new Filelocker "API" client. If a nil httpClient is
-// provided, http.DefaultClient will be used with a 30s timeout.  A userID, apiKey,
-// and baseURL must also be passed and a session will be established.
-func NewClient(userID, apiKey, baseURL string, httpClient *http.Client) (*Client, error) {
-	if httpClient == nil {
-		httpClient = &http.Client{
+// ParseDate parses a date returned by filelocker in the local time zone
+func ParseDate(s string) (time.Time, error) {
+	return parseDateIn(s, time.Local)
+}
+
+func parseDateIn(s string, loc *time.Location) (time.Time, error) {
+	return time.ParseInLocation(DateFormat, s, loc)
+}
+
+// parseDate parses a date returned by filelocker in the server's time zone
+func (c *Client) parseDate(s string) (time.Time, error) {
+	return parseDateIn(s, c.dateLocation())
+}
+
+// formatDate formats a date sent to filelocker in the server's time zone
+func (c *Client) formatDate(t time.Time) string {
+	return t.In(c.dateLocation()).Format(DateFormat)
+}
+
+// DateLocation returns the filelocker server's time zone set with WithDateLocation, the local
+// time zone by default.  Pass time.Now().In(c.DateLocation()) to PlanRenewals and PlanPrune so
+// they read the server's dates in its time zone.
+func (c *Client) DateLocation() *time.Location {
+	return c.dateLocation()
+}
+
+func (c *Client) dateLocation() *time.Location {
+	if c.location == nil {
+		return time.Local
+	}
+	return c.location
+}
+
+// New returns a new Filelocker "API" client for the server at baseURL without connecting to it.
+// The client logs in when Login is called, or on its first call when it has credentials.  By
+// default it uses an HTTP client with a 30s timeout.
+func New(baseURL string, opts ...Option) (*Client, error) {
+	bURL, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		BaseURL: bURL,
+		Client: &http.Client{
 			Timeout: 30 * time.Second,
+		},
+		userAgent: defaultUserAgent,
+		retry:     DefaultRetryPolicy,
+	}
+
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
 		}
 	}
 
-	if httpClient.Jar == nil {
+	if c.Client.Jar == nil {
 		jar, err := cookiejar.New(nil)
 		if err != nil {
 			return nil, err
 		}
-		httpClient.Jar = jar
+		c.Client.Jar = jar
 	}
 
-	bURL, err := url.Parse(baseURL)
+	return c, nil
+}
+
+// NewClient returns a new Filelocker "API" client. If a nil httpClient is
+// provided, http.DefaultClient will be used with a 30s timeout.  A userID, apiKey,
+// and baseURL must also be passed and a session will be established.  The options
+// configure the client further, see New.
+func NewClient(userID, apiKey, baseURL string, httpClient *http.Client, opts ...Option) (*Client, error) {
+	opts = append([]Option{WithCredentials(userID, apiKey), WithHTTPClient(httpClient)}, opts...)
+	c, err := New(baseURL, opts...)
 	if err != nil {
 		return nil, err
 	}
 
+	return c, c.Login(context.Background())
+}
+
+// Login establishes a session with the client's credentials
+func (c *Client) Login(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.login(ctx)
+}
+
+// login logs in, the caller must hold c.mu
+func (c *Client) login(ctx context.Context) error {
+	if c.credentials == nil {
+		return errors.New("no credentials to log into filelocker with")
+	}
+
+	userID, apiKey, err := c.credentials.Credentials(ctx)
+	if err != nil {
+		return err
+	}
+
 	form := url.Values{}
 	form.Add("CLIkey", apiKey)
 	form.Add("userId", userID)
 
-	url := fmt.Sprintf("%s/cli/CLI_login", baseURL)
+	url := fmt.Sprintf("%s/cli/CLI_login", c.BaseURL)
 	req, err := http.NewRequest("POST", url, strings.NewReader(form.Encode()))
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	req.Header.Add("Content-Type", defaultContentTypeHeader)
 	req.Header.Add("Accept", defaultAcceptHeader)
 
-	resp, err := httpClient.Do(req)
+	// logging in is safe to repeat, so it's retried like read-only calls
+	resp, err := c.sendRetry(c.Client, req.WithContext(ctx))
 	if err != nil {
-		return nil, err
+		c.log().Error("filelocker login failed", "user", userID, "error", err)
+		return err
 	}
 	defer func() {
 		if e := resp.Body.Close(); e != nil {
-			// TODO: log event
+			c.log().Warn("error closing filelocker response", "error", e)
 		}
 	}()
 
 	if resp.StatusCode > 200 {
 		msg := fmt.Sprintf("non-succcess response logging into filelocker: %s", resp.Status)
-		return nil, errors.New(msg)
+		return errors.New(msg)
 	}
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	type Result struct {
@@ -89,20 +190,150 @@ func NewClient(userID, apiKey, baseURL string, httpClient *http.Client) (*Client
 	var v Result
 	err = xml.Unmarshal(body, &v)
 	if err != nil {
+		return err
+	}
+
+	c.Errors = v.ErrorMessages
+	c.Messages = v.InfoMessages
+
+	if len(v.ErrorMessages) > 0 || len(v.InfoMessages) == 0 {
+		c.log().Error("filelocker login failed", "user", userID, "errors", v.ErrorMessages)
+		return errors.New("error logging into filelocker")
+	}
+	c.Origin = v.InfoMessages[0]
+	c.log().Info("logged into filelocker", "user", userID)
+
+	return nil
+}
+
+// Logout ends the client's filelocker session
+func (c *Client) Logout(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	url := fmt.Sprintf("%s/logout", c.BaseURL)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.send(c.Client, req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if e := resp.Body.Close(); e != nil {
+			c.log().Warn("error closing filelocker response", "error", e)
+		}
+	}()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("non-success response logging out of filelocker: %s", resp.Status)
+	}
+	c.log().Info("logged out of filelocker")
+
+	// forget the session cookies too, in case the server didn't expire them
+	c.Origin = ""
+	if c.Client.Jar != nil {
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			return err
+		}
+
+		client := *c.Client
+		client.Jar = jar
+		c.Client = &client
+	}
+
+	return nil
+}
+
+// loggedIn logs in if the client has credentials and no session yet.  It returns the HTTP
+// client to send requests with, since Logout replaces it.
+func (c *Client) loggedIn(ctx context.Context) (*http.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.ensureLogin(ctx); err != nil {
 		return nil, err
 	}
+	return c.Client, nil
+}
+
+// requestOrigin returns the request origin filelocker requires on changes, logging in first if needed
+func (c *Client) requestOrigin() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	client := Client{
-		Client:   httpClient,
-		BaseURL:  bURL,
-		Errors:   v.ErrorMessages,
-		Messages: v.InfoMessages,
+	if err := c.ensureLogin(context.Background()); err != nil {
+		return "", err
 	}
+	return c.Origin, nil
+}
 
-	if len(v.ErrorMessages) > 0 || len(v.InfoMessages) == 0 {
-		return &client, errors.New("error logging into filelocker")
+// ensureLogin logs in if the client has credentials and no session yet, the caller must hold c.mu
+func (c *Client) ensureLogin(ctx context.Context) error {
+	if c.Origin != "" || c.credentials == nil {
+		return nil
+	}
+	return c.login(ctx)
+}
+
+// do sends a request that changes something in filelocker, logging in first if needed.  It's
+// only retried when the retry policy allows retrying mutating calls.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	hc, err := c.loggedIn(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	if c.retry.RetryMutating {
+		return c.sendRetry(hc, req)
+	}
+	return c.send(hc, req)
+}
+
+// send sends a request to filelocker as-is with the HTTP client, once the client's rate and
+// in-flight limits allow it
+func (c *Client) send(hc *http.Client, req *http.Request) (*http.Response, error) {
+	release, err := c.acquire(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+
+	args := []interface{}{"method", req.Method, "path", req.URL.Path}
+	if q := req.URL.Query(); len(q) > 0 {
+		args = append(args, "query", redactValues(q).Encode())
+	}
+	c.log().Debug("filelocker request", args...)
+
+	if c.trace != nil {
+		c.trace.request(req)
+	}
+
+	start := time.Now()
+	resp, err := hc.Do(req)
+	if err != nil {
+		release()
+		if c.trace != nil {
+			c.trace.failure(err, time.Since(start))
+		}
+		c.log().Error("filelocker request failed", "method", req.Method, "path", req.URL.Path, "error", err)
+		return nil, err
+	}
+	c.log().Debug("filelocker response", "method", req.Method, "path", req.URL.Path, "status", resp.StatusCode, "duration", time.Since(start))
+
+	if c.trace != nil {
+		c.trace.response(req, resp, time.Since(start))
+	}
+
+	if c.inFlight != nil {
+		limitResponse(resp, release)
 	}
-	client.Origin = v.InfoMessages[0]
 
-	return &client, nil
+	return resp, nil
 }
@@ -1,11 +1,14 @@
 package filelocker_test
 
 import (
+	"context"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/YaleUniversity/go-filelocker/pkg/filelocker"
 )
@@ -71,3 +74,173 @@ func TestNewClient(t *testing.T) {
 
 	t.Log(client)
 }
+
+func TestSession(t *testing.T) {
+	var cookie string
+	fl := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.String() {
+		case "/cli/CLI_login":
+			w.Header().Set("Content-Type", "application/xml")
+			w.Header().Set("Set-Cookie", loginCookie+"; Path=/")
+			w.Write([]byte(loginResp))
+		case "/message/get_new_message_count":
+			cookie = r.Header.Get("Cookie")
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"data": 0, "sMessages": [], "fMessages": []}`))
+		default:
+			t.Errorf("unexpected url %s", r.URL)
+		}
+	}))
+	defer fl.Close()
+
+	client, err := filelocker.NewClient(testUser, testKey, fl.URL, nil)
+	if err != nil {
+		t.Fatal("error creating new filelocker client:", err)
+	}
+
+	session := client.Session()
+	if session.Origin != "123requestorigin321" || len(session.Cookies) != 1 {
+		t.Fatalf("expected session with origin and cookie, got %+v", session)
+	}
+
+	bURL, err := url.Parse(fl.URL)
+	if err != nil {
+		t.Error(err)
+	}
+
+	resumed := filelocker.Client{BaseURL: bURL}
+	if err := resumed.SetSession(session); err != nil {
+		t.Fatal("error resuming session:", err)
+	}
+
+	if _, err := resumed.SecureMessagesCount(); err != nil {
+		t.Fatal("error using resumed session:", err)
+	}
+
+	if cookie != loginCookie || resumed.Origin != "123requestorigin321" {
+		t.Errorf("expected resumed session to send cookie %s with origin, got %q %s", loginCookie, cookie, resumed.Origin)
+	}
+
+	if http.DefaultClient.Jar != nil {
+		t.Error("expected http.DefaultClient to be left without a cookie jar")
+	}
+}
+
+func TestNewLazyLogin(t *testing.T) {
+	// constructing a client doesn't need a reachable server
+	if _, err := filelocker.New("http://127.0.0.1:1", filelocker.WithCredentials(testUser, testKey)); err != nil {
+		t.Fatal("error creating new filelocker client:", err)
+	}
+
+	var logins, logouts int
+	fl := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.String() {
+		case "/cli/CLI_login":
+			logins++
+			w.Header().Set("Content-Type", "application/xml")
+			w.Header().Set("Set-Cookie", loginCookie+"; Path=/")
+			w.Write([]byte(loginResp))
+		case "/logout":
+			logouts++
+		case "/message/get_new_message_count":
+			if r.Header.Get("Cookie") != loginCookie {
+				t.Errorf("expected session cookie %s, got %q", loginCookie, r.Header.Get("Cookie"))
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"data": 0, "sMessages": [], "fMessages": []}`))
+		default:
+			t.Errorf("unexpected url %s", r.URL)
+		}
+	}))
+	defer fl.Close()
+
+	client, err := filelocker.New(fl.URL, filelocker.WithCredentials(testUser, testKey))
+	if err != nil {
+		t.Fatal("error creating new filelocker client:", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.SecureMessagesCount(); err != nil {
+			t.Fatal("error getting message count:", err)
+		}
+	}
+
+	if logins != 1 || client.Origin != "123requestorigin321" {
+		t.Errorf("expected 1 lazy login, got %d with origin %q", logins, client.Origin)
+	}
+
+	if err := client.Logout(context.Background()); err != nil {
+		t.Fatal("error logging out:", err)
+	}
+
+	if logouts != 1 || client.Origin != "" {
+		t.Errorf("expected to be logged out, got %d logouts with origin %q", logouts, client.Origin)
+	}
+
+	if _, err := client.SecureMessagesCount(); err != nil {
+		t.Fatal("error getting message count:", err)
+	}
+
+	if logins != 2 {
+		t.Errorf("expected to log in again after logging out, got %d logins", logins)
+	}
+}
+
+// TestLogoutConcurrent is meant for go test -race, logging out while other calls are made
+func TestLogoutConcurrent(t *testing.T) {
+	fl := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cli/CLI_login":
+			w.Header().Set("Content-Type", "application/xml")
+			w.Header().Set("Set-Cookie", loginCookie+"; Path=/")
+			w.Write([]byte(loginResp))
+		case "/logout":
+		case "/message/get_new_message_count":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"data": 0, "sMessages": [], "fMessages": []}`))
+		case "/message/create_message":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"sMessages": ["sent"], "fMessages": []}`))
+		default:
+			t.Errorf("unexpected url %s", r.URL)
+		}
+	}))
+	defer fl.Close()
+
+	client, err := filelocker.New(fl.URL, filelocker.WithCredentials(testUser, testKey))
+	if err != nil {
+		t.Fatal("error creating new filelocker client:", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			if err := client.Logout(context.Background()); err != nil {
+				t.Error("error logging out:", err)
+			}
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			if _, err := client.SecureMessagesCount(); err != nil {
+				t.Error("error getting message count:", err)
+			}
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			if _, err := client.NewSecureMessage("shh", "secret", []string{"user1"}, time.Now()); err != nil {
+				t.Error("error sending secure message:", err)
+			}
+			client.Session()
+		}
+	}()
+
+	wg.Wait()
+}
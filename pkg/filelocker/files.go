@@ -1,16 +1,20 @@
 package filelocker
 
 import (
-	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"mime"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // File is a file respresentation from filelocker
@@ -19,6 +23,68 @@ type File struct {
 	Name         string `xml:"name,attr"`
 	Size         int    `xml:"size,attr"`
 	PassedAvScan bool   `xml:"passedAvScan,attr"`
+	Status       string `xml:"status,attr"`
+	OwnerID      string `xml:"ownerId,attr"`
+	Expiration   string `xml:"expirationDate,attr"`
+	Uploaded     string `xml:"uploadDate,attr"`
+	Notes        string `xml:"notes,attr"`
+
+	// Metadata is the key/value metadata parsed from the notes, see ParseNotes
+	Metadata map[string]string `xml:"-"`
+}
+
+// Checksum returns the SHA-256 digest (in hex) and size of the uploaded bytes recorded in the
+// file's notes, if it was uploaded with a checksum
+func (f File) Checksum() (string, int64, bool) {
+	_, meta := ParseNotes(f.Notes)
+	sum, ok := meta["sha256"]
+	if !ok {
+		return "", 0, false
+	}
+
+	size, err := strconv.ParseInt(meta["size"], 10, 64)
+	if err != nil {
+		size = -1
+	}
+	return sum, size, true
+}
+
+// Scanning reports whether the file is still being virus scanned
+func (f File) Scanning() bool {
+	return strings.EqualFold(f.Status, "scanning")
+}
+
+// FailedScan reports whether the file has finished its virus scan without passing.  Files that
+// are still being scanned, or haven't been scanned yet, haven't failed.
+func (f File) FailedScan() bool {
+	return f.Status != "" && !f.Scanning() && !f.PassedAvScan
+}
+
+// HasTags reports whether the file's metadata contains all of the tags
+func (f File) HasTags(tags map[string]string) bool {
+	_, meta := ParseNotes(f.Notes)
+	for k, v := range tags {
+		if mv, ok := meta[k]; !ok || mv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// ErrFailedAvScan is returned when an uploaded file fails its virus scan
+var ErrFailedAvScan = errors.New("file failed virus scan")
+
+// ChecksumError is returned when a downloaded file doesn't match the checksum recorded in its
+// notes on upload
+type ChecksumError struct {
+	Expected     string
+	ExpectedSize int64
+	Actual       string
+	ActualSize   int64
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("checksum mismatch: expected sha256 %s (%d bytes), got %s (%d bytes)", e.Expected, e.ExpectedSize, e.Actual, e.ActualSize)
 }
 
 // FilesResponse is the response from filelocker for a list of the user's files
@@ -28,6 +94,23 @@ type FilesResponse struct {
 	InfoMessages  []string `xml:"messages>info"`
 }
 
+// Tagged returns the files with all of the tags in their metadata
+func (r *FilesResponse) Tagged(tags map[string]string) []File {
+	var files []File
+	for _, f := range r.Files {
+		if f.HasTags(tags) {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+func (r *FilesResponse) parseMetadata() {
+	for i := range r.Files {
+		_, r.Files[i].Metadata = ParseNotes(r.Files[i].Notes)
+	}
+}
+
 // Files lists the uploaded files in filelocker.  It requires an authenticated client.
 func (c *Client) Files() (*FilesResponse, error) {
 	form := url.Values{}
@@ -42,14 +125,14 @@ func (c *Client) Files() (*FilesResponse, error) {
 	req.Header.Add("Content-Type", defaultContentTypeHeader)
 	req.Header.Add("Accept", defaultAcceptHeader)
 
-	resp, err := c.Client.Do(req)
+	resp, err := c.doIdempotent(req)
 	if err != nil {
 		return nil, err
 	}
 
 	defer func() {
 		if e := resp.Body.Close(); e != nil {
-			// TODO: log event
+			c.log().Warn("error closing filelocker response", "error", e)
 		}
 	}()
 
@@ -64,13 +147,62 @@ func (c *Client) Files() (*FilesResponse, error) {
 		return nil, err
 	}
 
+	v.parseMetadata()
+
 	if len(v.ErrorMessages) > 0 {
+		c.log().Error("error listing file", "errors", v.ErrorMessages)
 		return &v, errors.New("error listing file")
 	}
 
 	return &v, nil
 }
 
+// SharedFiles lists the files other users have shared with the user in filelocker.  It requires an authenticated client.
+func (c *Client) SharedFiles() (*FilesResponse, error) {
+	form := url.Values{}
+	form.Add("format", "cli")
+
+	url := fmt.Sprintf("%s/file/get_files_shared_with_user", c.BaseURL)
+	req, err := http.NewRequest("POST", url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add("Content-Type", defaultContentTypeHeader)
+	req.Header.Add("Accept", defaultAcceptHeader)
+
+	resp, err := c.doIdempotent(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if e := resp.Body.Close(); e != nil {
+			c.log().Warn("error closing filelocker response", "error", e)
+		}
+	}()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var v FilesResponse
+	err = xml.Unmarshal(body, &v)
+	if err != nil {
+		return nil, err
+	}
+
+	v.parseMetadata()
+
+	if len(v.ErrorMessages) > 0 {
+		c.log().Error("error listing shared files", "errors", v.ErrorMessages)
+		return &v, errors.New("error listing shared files")
+	}
+
+	return &v, nil
+}
+
 // UploadResponse is the response from filelocker upload
 type UploadResponse struct {
 	ErrorMessages []string `xml:"messages>error"`
@@ -78,50 +210,98 @@ type UploadResponse struct {
 	File          File     `xml:"data>file"`
 }
 
-// Upload takes an io.ReadCloser , reads and uploads from it and then returns the response
+// UploadOptions are the optional details of an upload
+type UploadOptions struct {
+	Notes string
+
+	// Scan virus scans the file after it's uploaded
+	Scan bool
+
+	// Expiration is when the file expires, the server's default when zero
+	Expiration time.Time
+}
+
+// Upload takes an io.ReadCloser, streams it to filelocker and then returns the response.  When the
+// client has FileEncryption recipients, the file is encrypted as it is uploaded.  The SHA-256 digest
+// and size of the uploaded bytes are computed while streaming and recorded in the file's notes once
+// the upload finishes, so downloads can be verified.
 func (c *Client) Upload(name, notes string, scan bool, f io.Reader) (*UploadResponse, error) {
-	// yucky to take a Reader and then just read all the bytes =(
-	file, err := ioutil.ReadAll(f)
-	if err != nil {
-		return nil, err
+	return c.UploadWithOptions(name, f, UploadOptions{Notes: notes, Scan: scan})
+}
+
+// UploadWithOptions uploads a file like Upload, with the options.  A streamed upload can't be sent
+// again, so it isn't retried.  If the checksum can't be recorded after the upload, the response is
+// returned with the error and the file is left in filelocker without one.
+func (c *Client) UploadWithOptions(name string, f io.Reader, o UploadOptions) (*UploadResponse, error) {
+	notes, meta := ParseNotes(o.Notes)
+	if meta == nil {
+		meta = map[string]string{}
 	}
+	meta["tool"] = uploadTool
+
+	// the bytes are hashed as they're sent, so the checksum is only known after the upload
+	h := sha256.New()
+	counter := &countWriter{}
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		w := io.MultiWriter(pw, h, counter)
+
+		var err error
+		if c.FileEncryption != nil && len(c.FileEncryption.Recipients) > 0 {
+			err = c.FileEncryption.encrypt(w, f)
+		} else {
+			_, err = io.Copy(w, f)
+		}
+		pw.CloseWithError(err)
+		done <- err
+	}()
 
 	url := fmt.Sprintf("%s/file/upload", c.BaseURL)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(file))
+	req, err := http.NewRequest("POST", url, pr)
 	if err != nil {
+		pr.Close()
+		<-done
 		return nil, err
 	}
+	req.ContentLength = -1
 
 	// setup query parameters
 	params := req.URL.Query()
 	params.Add("format", "cli")
 	params.Add("fileName", name)
 
-	if scan {
-		params.Add("scanFile", strconv.FormatBool(scan))
+	if o.Scan {
+		params.Add("scanFile", strconv.FormatBool(o.Scan))
 	}
 
-	if notes == "" {
-		params.Add("fileNotes", "Uploaded by #golang")
-	} else {
-		params.Add("fileNotes", notes)
+	if !o.Expiration.IsZero() {
+		params.Add("expiration", c.formatDate(o.Expiration))
 	}
 
+	params.Add("fileNotes", FormatNotes(notes, meta))
+
 	req.URL.RawQuery = params.Encode()
 
 	// setup request headers
 	req.Header.Add("Content-Type", "application/octet-stream")
 	req.Header.Add("Accept", defaultAcceptHeader)
-	req.Header.Add("Content-Length", strconv.Itoa(len(file)))
 	req.Header.Add("X-File-Name", name)
 
-	resp, err := c.Client.Do(req)
+	resp, err := c.do(req)
+
+	// stop reading the file if filelocker didn't read all of it
+	pr.Close()
+	if copyErr := <-done; err == nil && copyErr != nil {
+		resp.Body.Close()
+		return nil, copyErr
+	}
 	if err != nil {
 		return nil, err
 	}
 	defer func() {
 		if e := resp.Body.Close(); e != nil {
-			// TODO: log event
+			c.log().Warn("error closing filelocker response", "error", e)
 		}
 	}()
 
@@ -137,12 +317,316 @@ func (c *Client) Upload(name, notes string, scan bool, f io.Reader) (*UploadResp
 	}
 
 	if len(v.ErrorMessages) > 0 {
+		c.log().Error("error uploading", "errors", v.ErrorMessages)
 		return &v, errors.New("error uploading")
 	}
 
+	if v.File.ID == "" {
+		return &v, errors.New("file uploaded, but filelocker didn't return its id to record the checksum")
+	}
+
+	meta["sha256"] = hex.EncodeToString(h.Sum(nil))
+	meta["size"] = strconv.FormatInt(counter.n, 10)
+	checked := FormatNotes(notes, meta)
+	if _, err := c.UpdateFile(v.File.ID, FileUpdate{Notes: &checked}); err != nil {
+		return &v, fmt.Errorf("file uploaded, but unable to record its checksum: %s", err)
+	}
+	v.File.Notes = checked
+	_, v.File.Metadata = ParseNotes(checked)
+
+	return &v, nil
+}
+
+// DownloadResponse describes a downloaded file
+type DownloadResponse struct {
+	Name      string
+	Size      int64
+	Encrypted bool
+	Decrypted bool
+
+	// Checksum is the SHA-256 digest recorded on upload, Verified is set once it's been checked
+	Checksum string
+	Verified bool
+}
+
+// Download writes the contents of a file to w.  Files encrypted with age are decrypted when the
+// client has FileEncryption identities, otherwise they are written as-is.  When the file was
+// uploaded with a checksum, the downloaded bytes are verified against it and a *ChecksumError is
+// returned if they differ; the contents already written to w must then be discarded.  The file
+// isn't downloaded if the file list can't be read to find its checksum.  It requires an
+// authenticated client.
+func (c *Client) Download(fileID string, w io.Writer) (*DownloadResponse, error) {
+	file, err := c.lookupFile(fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("%s/file/download", c.BaseURL)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	params := req.URL.Query()
+	params.Add("fileId", fileID)
+	req.URL.RawQuery = params.Encode()
+
+	resp, err := c.doIdempotent(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if e := resp.Body.Close(); e != nil {
+			c.log().Warn("error closing filelocker response", "error", e)
+		}
+	}()
+
+	if resp.StatusCode > 200 {
+		return nil, fmt.Errorf("non-success response downloading file: %s", resp.Status)
+	}
+
+	v := DownloadResponse{Name: fileID}
+	var size int64 = -1
+	if file != nil {
+		v.Checksum, size, _ = file.Checksum()
+	}
+
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		v.Name = params["filename"]
+	}
+
+	// hash the bytes as they were uploaded, before they're decrypted
+	h := sha256.New()
+	counter := &countWriter{}
+	raw := io.TeeReader(resp.Body, io.MultiWriter(h, counter))
+
+	r, encrypted, decrypted, err := c.FileEncryption.decrypt(raw)
+	v.Encrypted, v.Decrypted = encrypted, decrypted
+	if err != nil {
+		return &v, err
+	}
+
+	v.Size, err = io.Copy(w, r)
+	if err != nil {
+		return &v, err
+	}
+
+	if v.Checksum == "" {
+		return &v, nil
+	}
+
+	// decryption may stop short of the end of the download
+	if _, err := io.Copy(ioutil.Discard, raw); err != nil {
+		return &v, err
+	}
+
+	if sum := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(sum, v.Checksum) || (size >= 0 && size != counter.n) {
+		return &v, &ChecksumError{Expected: v.Checksum, ExpectedSize: size, Actual: sum, ActualSize: counter.n}
+	}
+	v.Verified = true
+
+	return &v, nil
+}
+
+// WaitForScan polls filelocker every interval until the file's virus scan has finished or the
+// context is done.  The scanned file is returned if it passed.  ErrFailedAvScan is returned if it
+// failed, or if it was removed from the user's files while it was being scanned since filelocker
+// deletes infected files.  Otherwise the context error is returned.
+func (c *Client) WaitForScan(ctx context.Context, fileID string, interval time.Duration) (*File, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		resp, err := c.Files()
+		if err != nil {
+			return nil, err
+		}
+
+		var file *File
+		for i := range resp.Files {
+			if resp.Files[i].ID == fileID {
+				file = &resp.Files[i]
+				break
+			}
+		}
+
+		switch {
+		case file == nil:
+			return nil, ErrFailedAvScan
+		case file.PassedAvScan:
+			return file, nil
+		case file.FailedScan():
+			return file, ErrFailedAvScan
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// lookupFile finds a file owned by or shared with the user, returning nil if it isn't listed
+func (c *Client) lookupFile(fileID string) (*File, error) {
+	for _, list := range []func() (*FilesResponse, error){c.Files, c.SharedFiles} {
+		resp, err := list()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range resp.Files {
+			if f.ID == fileID {
+				return &f, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// countWriter counts the bytes written to it
+type countWriter struct {
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// FileUpdate describes changes to a file, fields that are empty or nil are left unchanged
+type FileUpdate struct {
+	Name       string
+	Notes      *string
+	Expiration time.Time
+}
+
+// UpdateFileResponse is the response from filelocker for updating a file
+type UpdateFileResponse struct {
+	ErrorMessages []string `xml:"messages>error"`
+	InfoMessages  []string `xml:"messages>info"`
+}
+
+// UpdateFile changes a file's details.  It requires an authenticated client.
+func (c *Client) UpdateFile(fileID string, u FileUpdate) (*UpdateFileResponse, error) {
+	origin, err := c.requestOrigin()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Add("format", "cli")
+	form.Add("requestOrigin", origin)
+	form.Add("fileId", fileID)
+
+	if u.Name != "" {
+		form.Add("fileName", u.Name)
+	}
+
+	if u.Notes != nil {
+		form.Add("fileNotes", *u.Notes)
+	}
+
+	if !u.Expiration.IsZero() {
+		form.Add("expiration", c.formatDate(u.Expiration))
+	}
+
+	url := fmt.Sprintf("%s/file/update_file", c.BaseURL)
+	req, err := http.NewRequest("POST", url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add("Content-Type", defaultContentTypeHeader)
+	req.Header.Add("Accept", defaultAcceptHeader)
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if e := resp.Body.Close(); e != nil {
+			c.log().Warn("error closing filelocker response", "error", e)
+		}
+	}()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var v UpdateFileResponse
+	err = xml.Unmarshal(body, &v)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(v.ErrorMessages) > 0 {
+		c.log().Error("error updating file", "errors", v.ErrorMessages)
+		return &v, errors.New("error updating file")
+	}
+
 	return &v, nil
 }
 
+// TagFile sets and removes metadata tags on one of the user's files, keeping the rest of its
+// notes.  The checksum recorded on upload can't be changed, see ReservedMetadataKey.  It returns
+// the file as it was before the update.  It requires an authenticated client.
+func (c *Client) TagFile(fileID string, tags map[string]string, remove ...string) (*File, error) {
+	for k := range tags {
+		if ReservedMetadataKey(k) {
+			return nil, fmt.Errorf("%s is recorded on upload and can't be changed", k)
+		}
+	}
+
+	for _, k := range remove {
+		if ReservedMetadataKey(k) {
+			return nil, fmt.Errorf("%s is recorded on upload and can't be removed", k)
+		}
+	}
+
+	files, err := c.Files()
+	if err != nil {
+		return nil, err
+	}
+
+	var file *File
+	for i := range files.Files {
+		if files.Files[i].ID == fileID {
+			file = &files.Files[i]
+			break
+		}
+	}
+
+	if file == nil {
+		return nil, fmt.Errorf("file %s not found", fileID)
+	}
+
+	text, meta := ParseNotes(file.Notes)
+	if meta == nil {
+		meta = map[string]string{}
+	}
+
+	for k, v := range tags {
+		if !ValidMetadataKey(k) {
+			return nil, fmt.Errorf("invalid tag %q", k)
+		}
+		meta[k] = v
+	}
+
+	for _, k := range remove {
+		delete(meta, k)
+	}
+
+	notes := FormatNotes(text, meta)
+	if _, err := c.UpdateFile(fileID, FileUpdate{Notes: &notes}); err != nil {
+		return file, err
+	}
+
+	return file, nil
+}
+
 // DeleteResponse is the response from filelocker for a list of the user's groups
 type DeleteResponse struct {
 	ErrorMessages []string `xml:"messages>error"`
@@ -151,9 +635,14 @@ type DeleteResponse struct {
 
 // Delete removes a file from filelocker.  It requires an authenticated client.
 func (c *Client) Delete(files []string) (*DeleteResponse, error) {
+	origin, err := c.requestOrigin()
+	if err != nil {
+		return nil, err
+	}
+
 	form := url.Values{}
 	form.Add("format", "cli")
-	form.Add("requestOrigin", c.Origin)
+	form.Add("requestOrigin", origin)
 	fileIDs := strings.Join(files, ",")
 	form.Add("fileIds", fileIDs)
 
@@ -166,13 +655,13 @@ func (c *Client) Delete(files []string) (*DeleteResponse, error) {
 	req.Header.Add("Content-Type", defaultContentTypeHeader)
 	req.Header.Add("Accept", defaultAcceptHeader)
 
-	resp, err := c.Client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer func() {
 		if e := resp.Body.Close(); e != nil {
-			// TODO: log event
+			c.log().Warn("error closing filelocker response", "error", e)
 		}
 	}()
 
@@ -188,6 +677,7 @@ func (c *Client) Delete(files []string) (*DeleteResponse, error) {
 	}
 
 	if len(v.ErrorMessages) > 0 {
+		c.log().Error("error deleting file", "errors", v.ErrorMessages)
 		return &v, errors.New("error deleting file")
 	}
 
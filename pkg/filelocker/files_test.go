@@ -0,0 +1,454 @@
+package filelocker_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+
+	"github.com/YaleUniversity/go-filelocker/pkg/filelocker"
+)
+
+// fileServer stores an uploaded file and its notes and returns them from download and the file list
+func fileServer(t *testing.T, stored *[]byte) *httptest.Server {
+	var notes string
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/file/upload":
+			// the file is streamed, so its length and checksum aren't known until it's been sent
+			if r.ContentLength != -1 {
+				t.Errorf("expected a streamed upload, got content length %d", r.ContentLength)
+			}
+
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				t.Error("error reading body", err)
+			}
+			*stored = body
+			notes = r.URL.Query().Get("fileNotes")
+
+			if strings.Contains(notes, "sha256=") {
+				t.Errorf("expected the checksum to be recorded after the upload, got notes %q", notes)
+			}
+
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte(`<?xml version="1.0"?><cli_response><messages><info>File uploaded</info></messages><data><file id="42" name="secret.txt"/></data></cli_response>`))
+		case "/file/download":
+			if r.URL.Query().Get("fileId") != "42" {
+				t.Errorf("expected fileId parameter to be '42', got %s", r.URL.Query().Get("fileId"))
+			}
+
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("Content-Disposition", `attachment; filename="secret.txt"`)
+			w.Write(*stored)
+		case "/file/update_file":
+			if err := r.ParseForm(); err != nil {
+				t.Error(err)
+			}
+
+			if r.PostForm.Get("fileId") != "42" {
+				t.Errorf("expected fileId parameter to be '42', got %s", r.PostForm.Get("fileId"))
+			}
+			notes = r.PostForm.Get("fileNotes")
+
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte(`<?xml version="1.0"?><cli_response><messages><info>File updated</info></messages></cli_response>`))
+		case "/file/get_user_file_list":
+			var escaped bytes.Buffer
+			xml.EscapeText(&escaped, []byte(notes))
+
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprintf(w, `<?xml version="1.0"?><cli_response><messages/><data><file id="42" name="secret.txt" notes="%s"/></data></cli_response>`, escaped.String())
+		default:
+			t.Errorf("unexpected url %s", r.URL)
+		}
+	}))
+}
+
+func TestUploadDownloadEncrypted(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stored []byte
+	fl := fileServer(t, &stored)
+	defer fl.Close()
+
+	bURL, err := url.Parse(fl.URL)
+	if err != nil {
+		t.Error(err)
+	}
+
+	client := filelocker.Client{
+		Client:  http.DefaultClient,
+		Origin:  "123requestorigin321",
+		BaseURL: bURL,
+		FileEncryption: &filelocker.FileEncryption{
+			Recipients: []age.Recipient{identity.Recipient()},
+			Identities: []age.Identity{identity},
+		},
+	}
+
+	resp, err := client.Upload("secret.txt", "", false, strings.NewReader("some secret file"))
+	if err != nil {
+		t.Fatal("error uploading file", err)
+	}
+
+	if resp.File.ID != "42" {
+		t.Errorf("expected uploaded file id 42, got %s", resp.File.ID)
+	}
+
+	if !bytes.HasPrefix(stored, []byte("age-encryption.org/v1")) || bytes.Contains(stored, []byte("some secret file")) {
+		t.Errorf("expected server to only see an encrypted file, got %q", stored)
+	}
+
+	var out bytes.Buffer
+	download, err := client.Download("42", &out)
+	if err != nil {
+		t.Fatal("error downloading file", err)
+	}
+
+	if out.String() != "some secret file" {
+		t.Errorf("expected decrypted file 'some secret file', got %q", out.String())
+	}
+
+	sum := sha256.Sum256(stored)
+	expected := filelocker.DownloadResponse{
+		Name:      "secret.txt",
+		Size:      16,
+		Encrypted: true,
+		Decrypted: true,
+		Checksum:  hex.EncodeToString(sum[:]),
+		Verified:  true,
+	}
+	if *download != expected {
+		t.Errorf("expected: %+v\ngot: %+v", expected, *download)
+	}
+
+	// without identities the encrypted file is downloaded as-is
+	client.FileEncryption = nil
+	out.Reset()
+	download, err = client.Download("42", &out)
+	if err != nil {
+		t.Fatal("error downloading file", err)
+	}
+
+	if !bytes.Equal(out.Bytes(), stored) || !download.Encrypted || download.Decrypted {
+		t.Errorf("expected encrypted file to be downloaded as-is, got %+v", *download)
+	}
+}
+
+func TestUploadDownloadPassphrase(t *testing.T) {
+	recipient, err := age.NewScryptRecipient("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient.SetWorkFactor(10)
+
+	identity, err := age.NewScryptIdentity("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stored []byte
+	fl := fileServer(t, &stored)
+	defer fl.Close()
+
+	bURL, err := url.Parse(fl.URL)
+	if err != nil {
+		t.Error(err)
+	}
+
+	client := filelocker.Client{
+		Client:  http.DefaultClient,
+		Origin:  "123requestorigin321",
+		BaseURL: bURL,
+		FileEncryption: &filelocker.FileEncryption{
+			Recipients: []age.Recipient{recipient},
+			Identities: []age.Identity{identity},
+		},
+	}
+
+	if _, err := client.Upload("secret.txt", "", false, strings.NewReader("some secret file")); err != nil {
+		t.Fatal("error uploading file", err)
+	}
+
+	var out bytes.Buffer
+	if _, err := client.Download("42", &out); err != nil {
+		t.Fatal("error downloading file", err)
+	}
+
+	if out.String() != "some secret file" {
+		t.Errorf("expected decrypted file 'some secret file', got %q", out.String())
+	}
+}
+
+func TestDownloadChecksumMismatch(t *testing.T) {
+	var stored []byte
+	fl := fileServer(t, &stored)
+	defer fl.Close()
+
+	bURL, err := url.Parse(fl.URL)
+	if err != nil {
+		t.Error(err)
+	}
+
+	client := filelocker.Client{
+		Client:  http.DefaultClient,
+		Origin:  "123requestorigin321",
+		BaseURL: bURL,
+	}
+
+	if _, err := client.Upload("secret.txt", "quarterly report\nfinal", false, strings.NewReader("some file")); err != nil {
+		t.Fatal("error uploading file", err)
+	}
+
+	files, err := client.Files()
+	if err != nil {
+		t.Fatal("error listing files", err)
+	}
+
+	expected := sha256.Sum256([]byte("some file"))
+	sum, size, ok := files.Files[0].Checksum()
+	if !ok || size != 9 || sum != hex.EncodeToString(expected[:]) {
+		t.Errorf("expected checksum of 9 bytes in notes, got %q %d %t", sum, size, ok)
+	}
+
+	if !strings.HasPrefix(files.Files[0].Notes, "quarterly report\nfinal\n#filelocker sha256=") {
+		t.Errorf("expected notes to keep the text and end with the checksum, got %q", files.Files[0].Notes)
+	}
+
+	stored[0] = 'S'
+
+	var out bytes.Buffer
+	download, err := client.Download("42", &out)
+	if _, ok := err.(*filelocker.ChecksumError); !ok {
+		t.Fatalf("expected checksum error, got %v", err)
+	}
+
+	if download.Verified {
+		t.Error("expected corrupted download not to be verified")
+	}
+}
+
+func TestDownloadLookupFailure(t *testing.T) {
+	fl := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/file/get_user_file_list":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			t.Errorf("unexpected url %s", r.URL)
+		}
+	}))
+	defer fl.Close()
+
+	bURL, err := url.Parse(fl.URL)
+	if err != nil {
+		t.Error(err)
+	}
+
+	client := filelocker.Client{
+		Client:  http.DefaultClient,
+		Origin:  "123requestorigin321",
+		BaseURL: bURL,
+	}
+
+	// the checksum can't be found, so the file isn't downloaded unverified
+	var out bytes.Buffer
+	if _, err := client.Download("42", &out); err == nil {
+		t.Error("expected error when the file list fails, got nil")
+	}
+
+	if out.Len() > 0 {
+		t.Errorf("expected nothing downloaded, got %q", out.String())
+	}
+}
+
+func TestTagFile(t *testing.T) {
+	var stored []byte
+	fl := fileServer(t, &stored)
+	defer fl.Close()
+
+	bURL, err := url.Parse(fl.URL)
+	if err != nil {
+		t.Error(err)
+	}
+
+	client := filelocker.Client{
+		Client:  http.DefaultClient,
+		Origin:  "123requestorigin321",
+		BaseURL: bURL,
+	}
+
+	if _, err := client.Upload("secret.txt", "quarterly report\n#filelocker project=finance", false, strings.NewReader("some file")); err != nil {
+		t.Fatal("error uploading file", err)
+	}
+
+	if _, err := client.TagFile("42", map[string]string{"ticket": "INC 1234"}, "project"); err != nil {
+		t.Fatal("error tagging file", err)
+	}
+
+	files, err := client.Files()
+	if err != nil {
+		t.Fatal("error listing files", err)
+	}
+
+	f := files.Files[0]
+	if f.Metadata["ticket"] != "INC 1234" || f.Metadata["project"] != "" || f.Metadata["sha256"] == "" {
+		t.Errorf("expected ticket tag to be set and checksum kept, got %v", f.Metadata)
+	}
+
+	if text, _ := filelocker.ParseNotes(f.Notes); text != "quarterly report" {
+		t.Errorf("expected notes text to be kept, got %q", text)
+	}
+
+	if len(files.Tagged(map[string]string{"ticket": "INC 1234"})) != 1 || len(files.Tagged(map[string]string{"project": "finance"})) != 0 {
+		t.Error("expected files to be filtered by tag")
+	}
+
+	// the checksum can't be changed or removed
+	if _, err := client.TagFile("42", map[string]string{"sha256": "0000"}); err == nil {
+		t.Error("expected error setting the sha256 tag")
+	}
+
+	if _, err := client.TagFile("42", nil, "size"); err == nil {
+		t.Error("expected error removing the size tag")
+	}
+
+	files, err = client.Files()
+	if err != nil {
+		t.Fatal("error listing files", err)
+	}
+
+	if files.Files[0].Metadata["sha256"] != f.Metadata["sha256"] || files.Files[0].Metadata["size"] != f.Metadata["size"] {
+		t.Errorf("expected checksum to be kept, got %v", files.Files[0].Metadata)
+	}
+}
+
+func TestUploadExpirationAndUpdateFile(t *testing.T) {
+	expire := time.Date(2026, 12, 31, 0, 0, 0, 0, time.Local)
+
+	fl := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+
+		switch r.URL.Path {
+		case "/file/upload":
+			if r.URL.Query().Get("expiration") != "12/31/2026" {
+				t.Errorf("expected expiration parameter to be '12/31/2026', got %s", r.URL.Query().Get("expiration"))
+			}
+			w.Write([]byte(`<?xml version="1.0"?><cli_response><messages><info>File uploaded</info></messages><data><file id="42" name="report.txt"/></data></cli_response>`))
+		case "/file/update_file":
+			if err := r.ParseForm(); err != nil {
+				t.Error(err)
+			}
+
+			// the checksum is recorded once the upload finishes
+			if strings.Contains(r.PostForm.Get("fileNotes"), "sha256=") {
+				w.Write([]byte(`<?xml version="1.0"?><cli_response><messages><info>File updated</info></messages></cli_response>`))
+				return
+			}
+
+			expected := url.Values{
+				"format":        {"cli"},
+				"requestOrigin": {"123requestorigin321"},
+				"fileId":        {"42"},
+				"fileName":      {"report-final.txt"},
+				"expiration":    {"12/31/2026"},
+			}
+			if !reflect.DeepEqual(r.PostForm, expected) {
+				t.Errorf("expected: %v\ngot: %v", expected, r.PostForm)
+			}
+			w.Write([]byte(`<?xml version="1.0"?><cli_response><messages><info>File updated</info></messages></cli_response>`))
+		default:
+			t.Errorf("unexpected url %s", r.URL)
+		}
+	}))
+	defer fl.Close()
+
+	bURL, err := url.Parse(fl.URL)
+	if err != nil {
+		t.Error(err)
+	}
+
+	client := filelocker.Client{
+		Client:  http.DefaultClient,
+		Origin:  "123requestorigin321",
+		BaseURL: bURL,
+	}
+
+	if _, err := client.UploadWithOptions("report.txt", strings.NewReader("some file"), filelocker.UploadOptions{Expiration: expire}); err != nil {
+		t.Fatal("error uploading file", err)
+	}
+
+	if _, err := client.UpdateFile("42", filelocker.FileUpdate{Name: "report-final.txt", Expiration: expire}); err != nil {
+		t.Fatal("error updating file", err)
+	}
+}
+
+func TestWaitForScan(t *testing.T) {
+	lists := []string{
+		`<file id="42" name="clean.txt" status="Scanning" passedAvScan="false"/><file id="43" name="infected.txt" status="Scanning" passedAvScan="false"/>`,
+		`<file id="42" name="clean.txt" status="Processed" passedAvScan="true"/><file id="43" name="infected.txt" status="Processed" passedAvScan="false"/>`,
+	}
+
+	var polls int
+	fl := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/file/get_user_file_list" {
+			t.Errorf("got url %s, expected '/file/get_user_file_list'", r.URL)
+		}
+
+		list := lists[len(lists)-1]
+		if polls < len(lists) {
+			list = lists[polls]
+		}
+		polls++
+
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprintf(w, `<?xml version="1.0"?><cli_response><messages/><data>%s</data></cli_response>`, list)
+	}))
+	defer fl.Close()
+
+	bURL, err := url.Parse(fl.URL)
+	if err != nil {
+		t.Error(err)
+	}
+
+	client := filelocker.Client{
+		Client:  http.DefaultClient,
+		Origin:  "123requestorigin321",
+		BaseURL: bURL,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	f, err := client.WaitForScan(ctx, "42", 10*time.Millisecond)
+	if err != nil {
+		t.Fatal("error waiting for virus scan", err)
+	}
+
+	if !f.PassedAvScan || polls != 2 {
+		t.Errorf("expected file to pass its scan after 2 polls, got %+v after %d", f, polls)
+	}
+
+	if _, err := client.WaitForScan(ctx, "43", 10*time.Millisecond); err != filelocker.ErrFailedAvScan {
+		t.Errorf("expected failed virus scan error, got %v", err)
+	}
+
+	if _, err := client.WaitForScan(ctx, "44", 10*time.Millisecond); err != filelocker.ErrFailedAvScan {
+		t.Errorf("expected failed virus scan error for a deleted file, got %v", err)
+	}
+}
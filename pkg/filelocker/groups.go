@@ -37,13 +37,13 @@ func (c *Client) Groups() (*GroupsResponse, error) {
 	req.Header.Add("Content-Type", defaultContentTypeHeader)
 	req.Header.Add("Accept", defaultAcceptHeader)
 
-	resp, err := c.Client.Do(req)
+	resp, err := c.doIdempotent(req)
 	if err != nil {
 		return nil, err
 	}
 	defer func() {
 		if e := resp.Body.Close(); e != nil {
-			// TODO: log event
+			c.log().Warn("error closing filelocker response", "error", e)
 		}
 	}()
 
@@ -59,6 +59,7 @@ func (c *Client) Groups() (*GroupsResponse, error) {
 	}
 
 	if len(v.ErrorMessages) > 0 {
+		c.log().Error("error listing groups", "errors", v.ErrorMessages)
 		return &v, errors.New("error listing groups")
 	}
 
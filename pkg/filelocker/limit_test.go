@@ -0,0 +1,100 @@
+package filelocker_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/YaleUniversity/go-filelocker/pkg/filelocker"
+)
+
+// countServer counts the requests it's serving at once, keeping each open for a while
+func countServer(t *testing.T, hold time.Duration, mu *sync.Mutex, current, most *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/cli/CLI_login" {
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte(loginResp))
+			return
+		}
+
+		mu.Lock()
+		*current++
+		if *current > *most {
+			*most = *current
+		}
+		mu.Unlock()
+
+		time.Sleep(hold)
+
+		mu.Lock()
+		*current--
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data": 1, "sMessages": [], "fMessages": []}`))
+	}))
+}
+
+func TestMaxInFlight(t *testing.T) {
+	var mu sync.Mutex
+	var current, most int
+	fl := countServer(t, 20*time.Millisecond, &mu, &current, &most)
+	defer fl.Close()
+
+	client, err := filelocker.NewClient(testUser, testKey, fl.URL, nil, filelocker.WithMaxInFlight(2))
+	if err != nil {
+		t.Fatal("error creating new filelocker client:", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.SecureMessagesCount(); err != nil {
+				t.Error("error getting message count:", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if most > 2 {
+		t.Errorf("expected at most 2 requests in flight, got %d", most)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	var mu sync.Mutex
+	var current, most int
+	fl := countServer(t, 0, &mu, &current, &most)
+	defer fl.Close()
+
+	if _, err := filelocker.New(fl.URL, filelocker.WithRateLimit(0, 1)); err == nil {
+		t.Error("expected error for a rate limit of 0")
+	}
+
+	// the login uses the only token in the bucket
+	client, err := filelocker.NewClient(testUser, testKey, fl.URL, nil, filelocker.WithRateLimit(20, 1))
+	if err != nil {
+		t.Fatal("error creating new filelocker client:", err)
+	}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.SecureMessagesCount(); err != nil {
+				t.Error("error getting message count:", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if d := time.Since(start); d < 150*time.Millisecond {
+		t.Errorf("expected 4 requests at 20 a second to take at least 150ms, took %s", d)
+	}
+}
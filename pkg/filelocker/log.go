@@ -0,0 +1,52 @@
+package filelocker
+
+import "net/url"
+
+// Logger logs the client's events as a message and key/value pairs.  *slog.Logger satisfies it.
+// Requests are logged at debug level, retries at warn level and failures at error level.  The
+// api key, session cookies and message bodies are never logged.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// nopLogger discards events
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+
+// log returns the client's logger
+func (c *Client) log() Logger {
+	if c.logger == nil {
+		return nopLogger{}
+	}
+	return c.logger
+}
+
+// redacted replaces secret values in logs
+const redacted = "[REDACTED]"
+
+// secretFields are the form fields and query parameters that are redacted: the api key, the
+// request origin that's as good as the session, and message bodies
+var secretFields = map[string]bool{
+	"CLIkey":        true,
+	"requestOrigin": true,
+	"body":          true,
+}
+
+// redactValues returns a copy of form fields or query parameters with the secrets redacted
+func redactValues(v url.Values) url.Values {
+	r := make(url.Values, len(v))
+	for k, vals := range v {
+		if secretFields[k] {
+			vals = []string{redacted}
+		}
+		r[k] = vals
+	}
+	return r
+}
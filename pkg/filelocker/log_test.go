@@ -0,0 +1,87 @@
+package filelocker_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/YaleUniversity/go-filelocker/pkg/filelocker"
+)
+
+// testLogger records the messages logged
+type testLogger struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (l *testLogger) log(level, msg string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.msgs = append(l.msgs, fmt.Sprintf("%s %s %v", level, msg, args))
+}
+
+func (l *testLogger) Debug(msg string, args ...interface{}) { l.log("DEBUG", msg, args...) }
+func (l *testLogger) Info(msg string, args ...interface{})  { l.log("INFO", msg, args...) }
+func (l *testLogger) Warn(msg string, args ...interface{})  { l.log("WARN", msg, args...) }
+func (l *testLogger) Error(msg string, args ...interface{}) { l.log("ERROR", msg, args...) }
+
+// count returns the number of messages logged at a level
+func (l *testLogger) count(level string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n := 0
+	for _, m := range l.msgs {
+		if strings.HasPrefix(m, level+" ") {
+			n++
+		}
+	}
+	return n
+}
+
+func TestLoggerRedaction(t *testing.T) {
+	fl := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cli/CLI_login":
+			w.Header().Set("Content-Type", "application/xml")
+			w.Header().Set("Set-Cookie", loginCookie)
+			w.Write([]byte(loginResp))
+		case "/message/create_message":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"sMessages": [], "fMessages": ["recipient not found"]}`))
+		default:
+			t.Errorf("unexpected url %s", r.URL)
+		}
+	}))
+	defer fl.Close()
+
+	logger := &testLogger{}
+	client, err := filelocker.NewClient(testUser, testKey, fl.URL, nil, filelocker.WithLogger(logger))
+	if err != nil {
+		t.Fatal("error creating new filelocker client:", err)
+	}
+
+	if _, err := client.NewSecureMessage("shh", "the launch codes", []string{"nobody"}, time.Now()); err == nil {
+		t.Error("expected error sending secure message")
+	}
+
+	if logger.count("DEBUG") != 4 {
+		t.Errorf("expected the login and message requests and responses to be logged, got %v", logger.msgs)
+	}
+
+	if logger.count("ERROR") != 1 {
+		t.Errorf("expected the filelocker error to be logged, got %v", logger.msgs)
+	}
+
+	for _, m := range logger.msgs {
+		for _, secret := range []string{testKey, "123requestorigin321", "123sessiontoken321", "the launch codes"} {
+			if strings.Contains(m, secret) {
+				t.Errorf("expected %q to be redacted from %q", secret, m)
+			}
+		}
+	}
+}
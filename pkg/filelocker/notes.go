@@ -0,0 +1,129 @@
+package filelocker
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// notesMarker starts the line of key/value metadata appended to a file's notes
+const notesMarker = "#filelocker"
+
+// uploadTool identifies this library in the metadata of uploaded files
+var uploadTool = "go-filelocker/" + Version + VersionPrerelease
+
+// ParseNotes splits file notes into the free text and the key/value metadata.  Filelocker has no
+// tagging, so metadata (tags like project=x, and the checksum recorded on upload) is kept on the
+// last line of a file's free text notes:
+//
+//	Quarterly report for the board
+//	#filelocker project=finance sha256=9f86d0... size=1024 ticket="INC 1234" tool=go-filelocker/0.0.1
+//
+// Values containing spaces or quotes are quoted.  Notes without metadata are returned as-is with
+// nil metadata.
+func ParseNotes(notes string) (string, map[string]string) {
+	text, last := "", notes
+	if i := strings.LastIndex(notes, "\n"); i >= 0 {
+		text, last = notes[:i], notes[i+1:]
+	}
+
+	fields, ok := splitFields(strings.TrimSpace(last))
+	if !ok || len(fields) == 0 || fields[0] != notesMarker {
+		return notes, nil
+	}
+
+	meta := map[string]string{}
+	for _, f := range fields[1:] {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 || !ValidMetadataKey(kv[0]) {
+			return notes, nil
+		}
+
+		v := kv[1]
+		if strings.HasPrefix(v, `"`) {
+			var err error
+			if v, err = strconv.Unquote(v); err != nil {
+				return notes, nil
+			}
+		}
+		meta[kv[0]] = v
+	}
+
+	return text, meta
+}
+
+// FormatNotes appends the metadata, sorted by key, to the free text of file notes.  It's the
+// inverse of ParseNotes.
+func FormatNotes(text string, meta map[string]string) string {
+	if len(meta) == 0 {
+		return text
+	}
+
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	line := []string{notesMarker}
+	for _, k := range keys {
+		v := meta[k]
+		if v == "" || strings.IndexFunc(v, func(r rune) bool { return unicode.IsSpace(r) || r == '"' }) >= 0 {
+			v = strconv.Quote(v)
+		}
+		line = append(line, k+"="+v)
+	}
+
+	if text == "" {
+		return strings.Join(line, " ")
+	}
+	return text + "\n" + strings.Join(line, " ")
+}
+
+// ReservedMetadataKey reports whether k is one of the keys recorded on upload to verify downloads,
+// which can't be set or removed as tags
+func ReservedMetadataKey(k string) bool {
+	return k == "sha256" || k == "size" || k == "tool"
+}
+
+// ValidMetadataKey reports whether k can be used as a metadata key in file notes
+func ValidMetadataKey(k string) bool {
+	return k != "" && !strings.ContainsAny(k, "=\"") && strings.IndexFunc(k, unicode.IsSpace) < 0
+}
+
+// splitFields splits a line on spaces outside of double quotes
+func splitFields(s string) ([]string, bool) {
+	var fields []string
+	var quoted, escaped bool
+	start := -1
+	for i, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && r == '\\':
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+		case r == ' ' && !quoted:
+			if start >= 0 {
+				fields = append(fields, s[start:i])
+				start = -1
+			}
+			continue
+		}
+
+		if start < 0 {
+			start = i
+		}
+	}
+
+	if quoted {
+		return nil, false
+	}
+
+	if start >= 0 {
+		fields = append(fields, s[start:])
+	}
+	return fields, true
+}
@@ -0,0 +1,34 @@
+package filelocker_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/YaleUniversity/go-filelocker/pkg/filelocker"
+)
+
+func TestParseNotes(t *testing.T) {
+	meta := map[string]string{
+		"project":   "finance",
+		"ticket":    "INC 1234",
+		"retention": `say "hi"`,
+		"empty":     "",
+	}
+
+	notes := filelocker.FormatNotes("quarterly report\nfor the board", meta)
+	text, parsed := filelocker.ParseNotes(notes)
+	if text != "quarterly report\nfor the board" {
+		t.Errorf("expected notes text to round trip, got %q", text)
+	}
+
+	if !reflect.DeepEqual(parsed, meta) {
+		t.Errorf("expected metadata %v, got %v", meta, parsed)
+	}
+
+	for _, in := range []string{"", "just some notes", "#filelocker is great", "#filelocker a=\"unterminated"} {
+		text, meta := filelocker.ParseNotes(in)
+		if text != in || meta != nil {
+			t.Errorf("expected %q to have no metadata, got %q %v", in, text, meta)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package filelocker
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"time"
+)
+
+// defaultUserAgent identifies the library to filelocker
+var defaultUserAgent = uploadTool
+
+// Option configures a Client
+type Option func(*Client) error
+
+// WithCredentials logs in with a user id and api key
+func WithCredentials(userID, apiKey string) Option {
+	return WithCredentialsProvider(StaticCredentials{UserID: userID, APIKey: apiKey})
+}
+
+// WithCredentialsProvider logs in with credentials from the provider, which is asked for them
+// each time the client logs in
+func WithCredentialsProvider(p CredentialsProvider) Option {
+	return func(c *Client) error {
+		c.credentials = p
+		return nil
+	}
+}
+
+// WithHTTPClient sets the HTTP client used to talk to filelocker.  A cookie jar is added to it
+// when it doesn't have one, since filelocker sessions are cookies.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) error {
+		if httpClient != nil {
+			c.Client = httpClient
+		}
+		return nil
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent to filelocker, which defaults to go-filelocker/<version>
+func WithUserAgent(ua string) Option {
+	return func(c *Client) error {
+		c.userAgent = ua
+		return nil
+	}
+}
+
+// WithLogger logs the client's events, such as logins and retries
+func WithLogger(l Logger) Option {
+	return func(c *Client) error {
+		c.logger = l
+		return nil
+	}
+}
+
+// WithRetryPolicy sets how calls that fail are retried, see RetryPolicy.  Clients use
+// DefaultRetryPolicy unless it's set, and RetryPolicy{} turns retries off.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *Client) error {
+		c.retry = p
+		return nil
+	}
+}
+
+// WithBasePath is for filelocker servers that aren't at the root of their host, ie. /filelocker
+// for https://www.example.edu/filelocker
+func WithBasePath(p string) Option {
+	return func(c *Client) error {
+		c.BaseURL.Path = path.Join("/", c.BaseURL.Path, p)
+		return nil
+	}
+}
+
+// WithDateLocation sets the filelocker server's time zone, used for the dates it sends and
+// receives.  It defaults to the local time zone.
+func WithDateLocation(loc *time.Location) Option {
+	return func(c *Client) error {
+		c.location = loc
+		return nil
+	}
+}
+
+// WithTrace writes each request and response to w for troubleshooting: the request line, headers
+// and form fields, and the response status, headers and body.  The api key, request origin,
+// cookies and message bodies are redacted, and file contents are left out.
+func WithTrace(w io.Writer) Option {
+	return func(c *Client) error {
+		if w == nil {
+			c.trace = nil
+			return nil
+		}
+		c.trace = &tracer{w: w}
+		return nil
+	}
+}
+
+// WithRateLimit limits the client to perSecond requests a second on average, with bursts of up to
+// burst requests.  The limit is shared by every goroutine using the client, and retries and
+// logins count towards it.
+func WithRateLimit(perSecond float64, burst int) Option {
+	return func(c *Client) error {
+		if perSecond <= 0 {
+			return errors.New("rate limit must be more than 0 requests a second")
+		}
+		c.limiter = newRateLimiter(perSecond, burst)
+		return nil
+	}
+}
+
+// WithMaxInFlight limits the client to n requests at a time across every goroutine using it.  A
+// request is in flight until its response body is closed.
+func WithMaxInFlight(n int) Option {
+	return func(c *Client) error {
+		if n < 1 {
+			return errors.New("max in-flight requests must be at least 1")
+		}
+		c.inFlight = make(chan struct{}, n)
+		return nil
+	}
+}
@@ -0,0 +1,109 @@
+package filelocker_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/YaleUniversity/go-filelocker/pkg/filelocker"
+)
+
+type testCredentials struct{ calls int }
+
+func (c *testCredentials) Credentials(ctx context.Context) (string, string, error) {
+	c.calls++
+	return testUser, testKey, nil
+}
+
+func TestClientOptions(t *testing.T) {
+	var counts int
+	fl := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ua := r.Header.Get("User-Agent"); ua != "backup-job/1.0" {
+			t.Errorf("expected User-Agent 'backup-job/1.0', got %s", ua)
+		}
+
+		switch r.URL.Path {
+		case "/filelocker/cli/CLI_login":
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte(loginResp))
+		case "/filelocker/message/get_new_message_count":
+			// the load balancer fails the first attempt
+			counts++
+			if counts == 1 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"data": 3, "sMessages": [], "fMessages": []}`))
+		case "/filelocker/message/create_message":
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				t.Error("error reading body", err)
+			}
+
+			values, err := url.ParseQuery(string(body))
+			if err != nil {
+				t.Error(err)
+			}
+
+			// midnight in UTC is still the previous day in New York
+			if values.Get("expiration") != "12/30/2026" {
+				t.Errorf("expected expiration '12/30/2026', got %s", values.Get("expiration"))
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"sMessages": ["sent"], "fMessages": []}`))
+		default:
+			t.Errorf("unexpected url %s", r.URL)
+		}
+	}))
+	defer fl.Close()
+
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no time zone database:", err)
+	}
+
+	creds := &testCredentials{}
+	logger := &testLogger{}
+	client, err := filelocker.NewClient("", "", fl.URL, nil,
+		filelocker.WithCredentialsProvider(creds),
+		filelocker.WithUserAgent("backup-job/1.0"),
+		filelocker.WithBasePath("/filelocker"),
+		filelocker.WithDateLocation(loc),
+		filelocker.WithLogger(logger),
+		filelocker.WithRetryPolicy(filelocker.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}),
+	)
+	if err != nil {
+		t.Fatal("error creating new filelocker client:", err)
+	}
+
+	if creds.calls != 1 {
+		t.Errorf("expected credentials provider to be called once, got %d", creds.calls)
+	}
+
+	if client.DateLocation() != loc {
+		t.Errorf("expected date location %s, got %s", loc, client.DateLocation())
+	}
+
+	resp, err := client.SecureMessagesCount()
+	if err != nil {
+		t.Fatal("error getting message count:", err)
+	}
+
+	if resp.Count != 3 || counts != 2 {
+		t.Errorf("expected count of 3 after a retry, got %d after %d attempts", resp.Count, counts)
+	}
+
+	expire := time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC)
+	if _, err := client.NewSecureMessage("shh", "secret", []string{"user1"}, expire); err != nil {
+		t.Fatal("error sending secure message:", err)
+	}
+
+	if logger.count("INFO") != 1 || logger.count("WARN") != 1 {
+		t.Errorf("expected a login and a retry to be logged, got %v", logger.msgs)
+	}
+}
@@ -0,0 +1,331 @@
+package filelocker
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/clearsign"
+)
+
+const (
+	pgpMessageHeader = "-----BEGIN PGP MESSAGE-----"
+	pgpSignedHeader  = "-----BEGIN PGP SIGNED MESSAGE-----"
+)
+
+// PGP configures end-to-end OpenPGP encryption and signing of secure message bodies, so
+// they can't be read by filelocker server administrators.
+//
+// Recipients' public keys are found in the Keyring by matching the recipient id to the full
+// email of a key identity or to a key id.  The Keyring also holds the private keys used to
+// decrypt received messages and the public keys used to verify signatures.
+type PGP struct {
+	Keyring openpgp.EntityList
+
+	// Domain is added to recipient ids that aren't emails to find their keys, ie. netid123 is
+	// looked up as netid123@example.edu with a Domain of example.edu
+	Domain string
+
+	// Encrypt encrypts new message bodies to the recipients and the Signer
+	Encrypt bool
+
+	// Signer signs new message bodies when set
+	Signer *openpgp.Entity
+
+	// Passphrase is called, at most once, when an encrypted private key needs to be unlocked
+	Passphrase func() ([]byte, error)
+
+	mu         sync.Mutex
+	passphrase []byte
+}
+
+// PGPStatus describes the OpenPGP protection of a received message body
+type PGPStatus struct {
+	Encrypted bool   `json:"encrypted"`
+	Signed    bool   `json:"signed"`
+	SignedBy  string `json:"signedBy,omitempty"`
+	Verified  bool   `json:"verified"`
+	Error     string `json:"error,omitempty"`
+}
+
+// LoadKeyring reads armored or binary OpenPGP keyrings from files
+func LoadKeyring(paths ...string) (openpgp.EntityList, error) {
+	var keyring openpgp.EntityList
+	for _, p := range paths {
+		data, err := ioutil.ReadFile(os.ExpandEnv(p))
+		if err != nil {
+			return nil, err
+		}
+
+		el, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+		if err != nil {
+			el, err = openpgp.ReadKeyRing(bytes.NewReader(data))
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("unable to read keyring %s: %s", p, err)
+		}
+		keyring = append(keyring, el...)
+	}
+
+	return keyring, nil
+}
+
+// FindKey finds the entity in the keyring with an identity whose email is the id, or whose key
+// id (in hex) is the id.  It fails when no key or more than one key matches, so a message is
+// never encrypted to a key that was only a guess.
+func FindKey(keyring openpgp.EntityList, id string) (*openpgp.Entity, error) {
+	want := strings.ToLower(strings.TrimPrefix(id, "0x"))
+
+	var found *openpgp.Entity
+	for _, e := range keyring {
+		if !keyMatches(e, want) {
+			continue
+		}
+
+		// the same key can be in more than one keyring
+		if found != nil && found.PrimaryKey.Fingerprint != e.PrimaryKey.Fingerprint {
+			return nil, fmt.Errorf("more than one key found for %s", id)
+		}
+		found = e
+	}
+
+	if found == nil {
+		return nil, fmt.Errorf("no key found for %s", id)
+	}
+	return found, nil
+}
+
+// keyMatches reports whether the entity has the lowercase email or hex key id
+func keyMatches(e *openpgp.Entity, id string) bool {
+	if fmt.Sprintf("%016x", e.PrimaryKey.KeyId) == id || e.PrimaryKey.KeyIdShortString() == strings.ToUpper(id) {
+		return true
+	}
+
+	for _, ident := range e.Identities {
+		if ident.UserId.Email != "" && strings.ToLower(ident.UserId.Email) == id {
+			return true
+		}
+	}
+	return false
+}
+
+// seal signs and/or encrypts a message body for the recipients
+func (p *PGP) seal(msg string, recipients []string) (string, error) {
+	if p.Signer != nil {
+		if err := p.unlock(p.Signer); err != nil {
+			return "", err
+		}
+	}
+
+	var out bytes.Buffer
+	if !p.Encrypt {
+		w, err := clearsign.Encode(&out, p.Signer.PrivateKey, nil)
+		if err != nil {
+			return "", err
+		}
+
+		if _, err := w.Write([]byte(msg)); err != nil {
+			return "", err
+		}
+
+		if err := w.Close(); err != nil {
+			return "", err
+		}
+
+		return out.String(), nil
+	}
+
+	var to []*openpgp.Entity
+	for _, r := range recipients {
+		if p.Domain != "" && !strings.Contains(r, "@") {
+			r = r + "@" + p.Domain
+		}
+
+		e, err := FindKey(p.Keyring, r)
+		if err != nil {
+			return "", fmt.Errorf("unable to find public key for recipient: %s", err)
+		}
+		to = append(to, e)
+	}
+
+	if p.Signer != nil {
+		to = append(to, p.Signer)
+	}
+
+	aw, err := armor.Encode(&out, "PGP MESSAGE", nil)
+	if err != nil {
+		return "", err
+	}
+
+	w, err := openpgp.Encrypt(aw, to, p.Signer, nil, nil)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := w.Write([]byte(msg)); err != nil {
+		return "", err
+	}
+
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	if err := aw.Close(); err != nil {
+		return "", err
+	}
+
+	return out.String(), nil
+}
+
+// open decrypts and verifies an OpenPGP protected message body in place.  Bodies that aren't
+// protected are left alone.  Failures are recorded in the message's PGP status.
+func (p *PGP) open(m *SecureMessage) {
+	body := strings.TrimSpace(m.Body)
+
+	switch {
+	case strings.HasPrefix(body, pgpMessageHeader):
+		m.PGP = &PGPStatus{Encrypted: true}
+
+		block, err := armor.Decode(strings.NewReader(body))
+		if err != nil {
+			m.PGP.Error = err.Error()
+			return
+		}
+
+		md, err := openpgp.ReadMessage(block.Body, p.Keyring, p.prompt, nil)
+		if err != nil {
+			m.PGP.Error = err.Error()
+			return
+		}
+
+		plain, err := ioutil.ReadAll(md.UnverifiedBody)
+		if err != nil {
+			m.PGP.Error = err.Error()
+			return
+		}
+		m.Body = string(plain)
+
+		if md.IsSigned {
+			m.PGP.Signed = true
+			p.verified(m.PGP, md.SignedBy, md.SignatureError)
+		}
+
+	case strings.HasPrefix(body, pgpSignedHeader):
+		m.PGP = &PGPStatus{Signed: true}
+
+		block, _ := clearsign.Decode([]byte(body))
+		if block == nil {
+			m.PGP.Error = "invalid signed message"
+			return
+		}
+		// the line ending before the signature isn't part of the signed text
+		m.Body = strings.TrimSuffix(string(block.Plaintext), "\n")
+
+		signer, err := openpgp.CheckDetachedSignature(p.Keyring, bytes.NewReader(block.Bytes), block.ArmoredSignature.Body)
+		if signer != nil {
+			p.verified(m.PGP, &openpgp.Key{Entity: signer}, err)
+		} else {
+			p.verified(m.PGP, nil, err)
+		}
+	}
+}
+
+// verified records the result of checking a signature
+func (p *PGP) verified(status *PGPStatus, key *openpgp.Key, err error) {
+	if key != nil && key.Entity != nil {
+		for name := range key.Entity.Identities {
+			status.SignedBy = name
+			break
+		}
+	}
+
+	switch {
+	case err != nil:
+		status.Error = "bad signature: " + err.Error()
+	case key == nil:
+		status.Error = "signed by an unknown key"
+	default:
+		status.Verified = true
+	}
+}
+
+// prompt unlocks the private keys openpgp.ReadMessage needs to decrypt a message
+func (p *PGP) prompt(keys []openpgp.Key, symmetric bool) ([]byte, error) {
+	if symmetric {
+		return nil, errors.New("symmetrically encrypted messages are not supported")
+	}
+
+	var unlocked bool
+	for _, k := range keys {
+		if k.PrivateKey == nil || !k.PrivateKey.Encrypted {
+			continue
+		}
+
+		pass, err := p.getPassphrase()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := k.PrivateKey.Decrypt(pass); err != nil {
+			return nil, errors.New("unable to unlock private key")
+		}
+		unlocked = true
+	}
+
+	// ReadMessage keeps prompting until a key works, so stop once there's nothing left to unlock
+	if !unlocked {
+		return nil, errors.New("no private key can decrypt the message")
+	}
+
+	return nil, nil
+}
+
+// unlock decrypts an entity's private signing key
+func (p *PGP) unlock(e *openpgp.Entity) error {
+	if e.PrivateKey == nil {
+		return errors.New("signing key has no private key")
+	}
+
+	if !e.PrivateKey.Encrypted {
+		return nil
+	}
+
+	pass, err := p.getPassphrase()
+	if err != nil {
+		return err
+	}
+
+	if err := e.PrivateKey.Decrypt(pass); err != nil {
+		return errors.New("unable to unlock signing key")
+	}
+
+	return nil
+}
+
+func (p *PGP) getPassphrase() ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.passphrase != nil {
+		return p.passphrase, nil
+	}
+
+	if p.Passphrase == nil {
+		return nil, errors.New("private key is encrypted and no passphrase was given")
+	}
+
+	pass, err := p.Passphrase()
+	if err != nil {
+		return nil, err
+	}
+	p.passphrase = pass
+
+	return pass, nil
+}
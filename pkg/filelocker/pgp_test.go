@@ -0,0 +1,227 @@
+package filelocker_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/YaleUniversity/go-filelocker/pkg/filelocker"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// pgpServer accepts a new secure message and returns it from get_messages
+func pgpServer(t *testing.T) *httptest.Server {
+	var sent string
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.String() {
+		case "/message/create_message":
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				t.Error("error reading body", err)
+			}
+
+			values, err := url.ParseQuery(string(body))
+			if err != nil {
+				t.Error(err)
+			}
+			sent = values.Get("body")
+			w.Write([]byte(`{"sMessages": ["sent"], "fMessages": []}`))
+		case "/message/get_messages":
+			resp := map[string]interface{}{
+				"sMessages": []string{},
+				"fMessages": []string{},
+				"data": [][]filelocker.SecureMessage{
+					{{ID: 1, OwnerID: "testuser", Subject: "shh", Body: sent}},
+				},
+			}
+			if err := json.NewEncoder(w).Encode(resp); err != nil {
+				t.Error(err)
+			}
+		default:
+			t.Errorf("unexpected url %s", r.URL)
+		}
+	}))
+}
+
+// newTestEntity creates a key with algorithm preferences like those set by gpg
+func newTestEntity(t *testing.T, name, email string) *openpgp.Entity {
+	e, err := openpgp.NewEntity(name, "", email, &packet.Config{RSABits: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ident := range e.Identities {
+		ident.SelfSignature.PreferredSymmetric = []uint8{uint8(packet.CipherAES256)}
+		ident.SelfSignature.PreferredHash = []uint8{8} // SHA256
+	}
+
+	return e
+}
+
+func TestPGPEncryptedMessage(t *testing.T) {
+	sender := newTestEntity(t, "Test User", "testuser@example.edu")
+	recipient := newTestEntity(t, "User One", "user1@example.edu")
+
+	fl := pgpServer(t)
+	defer fl.Close()
+
+	bURL, err := url.Parse(fl.URL)
+	if err != nil {
+		t.Error(err)
+	}
+
+	client := filelocker.Client{
+		Client:  http.DefaultClient,
+		Origin:  "123requestorigin321",
+		BaseURL: bURL,
+		PGP: &filelocker.PGP{
+			Keyring: openpgp.EntityList{sender, recipient},
+			Domain:  "example.edu",
+			Encrypt: true,
+			Signer:  sender,
+		},
+	}
+
+	if _, err := client.NewSecureMessage("shh", "some secret message", []string{"user1"}, time.Now()); err != nil {
+		t.Fatal("error sending secure message", err)
+	}
+
+	// the recipient only has their own private key and the sender's public key
+	var private, public bytes.Buffer
+	if err := sender.SerializePrivate(&private, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sender.Serialize(&public); err != nil {
+		t.Fatal(err)
+	}
+
+	senderPublic, err := openpgp.ReadEntity(packet.NewReader(&public))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.PGP = &filelocker.PGP{Keyring: openpgp.EntityList{recipient, senderPublic}}
+
+	resp, err := client.SecureMessages()
+	if err != nil {
+		t.Fatal("error listing secure messages", err)
+	}
+
+	m := resp.Received()[0]
+	if m.Body != "some secret message" {
+		t.Errorf("expected decrypted body 'some secret message', got %s", m.Body)
+	}
+
+	expected := filelocker.PGPStatus{
+		Encrypted: true,
+		Signed:    true,
+		SignedBy:  "Test User <testuser@example.edu>",
+		Verified:  true,
+	}
+	if m.PGP == nil || *m.PGP != expected {
+		t.Errorf("expected pgp status %+v, got %+v", expected, m.PGP)
+	}
+
+	client.PGP = nil
+	resp, err = client.SecureMessages()
+	if err != nil {
+		t.Fatal("error listing secure messages", err)
+	}
+
+	if !strings.HasPrefix(resp.Received()[0].Body, "-----BEGIN PGP MESSAGE-----") {
+		t.Errorf("expected server to only see an encrypted body, got %s", resp.Received()[0].Body)
+	}
+}
+
+func TestFindKey(t *testing.T) {
+	user1 := newTestEntity(t, "User One", "user1@example.edu")
+	other := newTestEntity(t, "User One", "user1@elsewhere.example")
+
+	keyring := openpgp.EntityList{user1, other}
+
+	e, err := filelocker.FindKey(keyring, "User1@Example.edu")
+	if err != nil {
+		t.Fatal("expected key by email, got", err)
+	}
+
+	if e != user1 {
+		t.Error("expected the key for user1@example.edu")
+	}
+
+	e, err = filelocker.FindKey(keyring, "0x"+fmt.Sprintf("%016X", other.PrimaryKey.KeyId))
+	if err != nil {
+		t.Fatal("expected key by key id, got", err)
+	}
+
+	if e != other {
+		t.Error("expected the key with the key id")
+	}
+
+	// the local part of an email and the name don't pick a key
+	for _, id := range []string{"user1", "User One"} {
+		if _, err := filelocker.FindKey(keyring, id); err == nil {
+			t.Errorf("expected no key for %s", id)
+		}
+	}
+
+	// the same key in two keyrings isn't ambiguous, two keys with the email are
+	if _, err := filelocker.FindKey(openpgp.EntityList{user1, user1}, "user1@example.edu"); err != nil {
+		t.Error("expected a key listed twice to be found, got", err)
+	}
+
+	twin := newTestEntity(t, "Someone Else", "user1@example.edu")
+	if _, err := filelocker.FindKey(openpgp.EntityList{user1, twin}, "user1@example.edu"); err == nil {
+		t.Error("expected error when two keys have the email")
+	}
+}
+
+func TestPGPSignedMessage(t *testing.T) {
+	sender := newTestEntity(t, "Test User", "testuser@example.edu")
+
+	fl := pgpServer(t)
+	defer fl.Close()
+
+	bURL, err := url.Parse(fl.URL)
+	if err != nil {
+		t.Error(err)
+	}
+
+	client := filelocker.Client{
+		Client:  http.DefaultClient,
+		Origin:  "123requestorigin321",
+		BaseURL: bURL,
+		PGP: &filelocker.PGP{
+			Keyring: openpgp.EntityList{sender},
+			Signer:  sender,
+		},
+	}
+
+	if _, err := client.NewSecureMessage("shh", "some signed message", []string{"user1"}, time.Now()); err != nil {
+		t.Fatal("error sending secure message", err)
+	}
+
+	resp, err := client.SecureMessages()
+	if err != nil {
+		t.Fatal("error listing secure messages", err)
+	}
+
+	m := resp.Received()[0]
+	if m.Body != "some signed message" {
+		t.Errorf("expected body 'some signed message', got %q", m.Body)
+	}
+
+	if m.PGP == nil || !m.PGP.Signed || !m.PGP.Verified || m.PGP.Encrypted {
+		t.Errorf("expected a verified, unencrypted signature, got %+v", m.PGP)
+	}
+}
@@ -0,0 +1,148 @@
+package filelocker
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sizeUnits are the units accepted by ParseSize
+var sizeUnits = map[string]int64{
+	"":    1,
+	"b":   1,
+	"k":   1 << 10,
+	"kb":  1 << 10,
+	"kib": 1 << 10,
+	"m":   1 << 20,
+	"mb":  1 << 20,
+	"mib": 1 << 20,
+	"g":   1 << 30,
+	"gb":  1 << 30,
+	"gib": 1 << 30,
+	"t":   1 << 40,
+	"tb":  1 << 40,
+	"tib": 1 << 40,
+}
+
+// ParseSize parses a size in bytes like 512, 100KB, 1.5GiB or 2g.  Units are powers of 1024.
+func ParseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i < 0 {
+		i = len(s)
+	}
+
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	unit, ok := sizeUnits[strings.ToLower(strings.TrimSpace(s[i:]))]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q, unknown unit %q", s, s[i:])
+	}
+
+	return int64(n * float64(unit)), nil
+}
+
+// PruneOptions selects files to delete.  A file must match all of the selectors that are set.
+type PruneOptions struct {
+	// OlderThan selects files uploaded more than the duration ago
+	OlderThan time.Duration
+
+	// Name selects files with names matching the glob, see path.Match
+	Name string
+
+	// FailedAvScan selects files that have finished a virus scan without passing it
+	FailedAvScan bool
+
+	// LargerThan selects files larger than the size in bytes
+	LargerThan int64
+
+	// Tags selects files with all of the tags in their metadata
+	Tags map[string]string
+
+	// KeepNewest keeps the newest files with each name, even if they match the other selectors
+	KeepNewest int
+}
+
+// PlanPrune selects the files to delete.  Dates are in now's time zone, which should be the
+// client's DateLocation.
+func PlanPrune(files []File, o PruneOptions, now time.Time) ([]File, error) {
+	if o.OlderThan <= 0 && o.Name == "" && !o.FailedAvScan && o.LargerThan <= 0 && len(o.Tags) == 0 && o.KeepNewest <= 0 {
+		return nil, errors.New("at least one selector must be set")
+	}
+
+	if o.Name != "" {
+		if _, err := path.Match(o.Name, ""); err != nil {
+			return nil, fmt.Errorf("invalid name pattern %q: %s", o.Name, err)
+		}
+	}
+
+	keep := map[string]bool{}
+	if o.KeepNewest > 0 {
+		byName := map[string][]File{}
+		for _, f := range files {
+			byName[f.Name] = append(byName[f.Name], f)
+		}
+
+		for _, named := range byName {
+			sort.SliceStable(named, func(i, j int) bool { return uploadedAfter(named[i], named[j]) })
+			for i := 0; i < len(named) && i < o.KeepNewest; i++ {
+				keep[named[i].ID] = true
+			}
+		}
+	}
+
+	var prune []File
+	for _, f := range files {
+		if keep[f.ID] {
+			continue
+		}
+
+		if o.OlderThan > 0 {
+			uploaded, err := parseDateIn(f.Uploaded, now.Location())
+			if err != nil || now.Sub(uploaded) < o.OlderThan {
+				continue
+			}
+		}
+
+		if o.Name != "" {
+			if ok, _ := path.Match(o.Name, f.Name); !ok {
+				continue
+			}
+		}
+
+		if (o.FailedAvScan && !f.FailedScan()) || (o.LargerThan > 0 && int64(f.Size) <= o.LargerThan) || !f.HasTags(o.Tags) {
+			continue
+		}
+
+		prune = append(prune, f)
+	}
+
+	return prune, nil
+}
+
+// uploadedAfter reports whether a was uploaded after b, files with an unknown upload date are
+// the oldest and files uploaded on the same day are ordered by id
+func uploadedAfter(a, b File) bool {
+	ua, errA := parseDateIn(a.Uploaded, time.Local)
+	ub, errB := parseDateIn(b.Uploaded, time.Local)
+	switch {
+	case errA != nil || errB != nil:
+		return errA == nil && errB != nil
+	case !ua.Equal(ub):
+		return ua.After(ub)
+	}
+
+	ia, errA := strconv.ParseInt(a.ID, 10, 64)
+	ib, errB := strconv.ParseInt(b.ID, 10, 64)
+	if errA != nil || errB != nil {
+		return a.ID > b.ID
+	}
+	return ia > ib
+}
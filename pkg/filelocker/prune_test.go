@@ -0,0 +1,85 @@
+package filelocker_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/YaleUniversity/go-filelocker/pkg/filelocker"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{
+		"512":    512,
+		"100KB":  100 << 10,
+		"1.5GiB": 3 << 29,
+		"2g":     2 << 30,
+		"10 mb":  10 << 20,
+	}
+
+	for in, expected := range tests {
+		actual, err := filelocker.ParseSize(in)
+		if err != nil {
+			t.Errorf("error parsing size %s: %s", in, err)
+			continue
+		}
+
+		if actual != expected {
+			t.Errorf("expected %s to parse as %d, got %d", in, expected, actual)
+		}
+	}
+
+	for _, in := range []string{"", "MB", "5XB", "-1"} {
+		if _, err := filelocker.ParseSize(in); err == nil {
+			t.Errorf("expected error parsing size %q, got nil", in)
+		}
+	}
+}
+
+func TestPlanPrune(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.Local)
+	day := 24 * time.Hour
+
+	files := []filelocker.File{
+		{ID: "1", Name: "backup.tgz", Size: 5 << 20, PassedAvScan: true, Uploaded: "08/01/2026"},
+		{ID: "2", Name: "backup.tgz", Size: 5 << 20, PassedAvScan: true, Uploaded: "09/01/2026"},
+		{ID: "3", Name: "backup.tgz", Size: 5 << 20, PassedAvScan: true, Uploaded: "09/25/2026"},
+		{ID: "4", Name: "report.pdf", Size: 1 << 20, PassedAvScan: false, Status: "Processed", Uploaded: "08/01/2026"},
+		{ID: "5", Name: "notes.txt", Size: 1 << 10, PassedAvScan: true, Status: "Processed", Uploaded: "09/30/2026"},
+		{ID: "6", Name: "upload.zip", Size: 1 << 10, PassedAvScan: false, Status: "Scanning", Uploaded: "10/01/2026"},
+		{ID: "7", Name: "unscanned.zip", Size: 1 << 10, PassedAvScan: false, Uploaded: "10/01/2026"},
+	}
+
+	tests := []struct {
+		opts     filelocker.PruneOptions
+		expected []string
+	}{
+		{filelocker.PruneOptions{OlderThan: 14 * day}, []string{"1", "2", "4"}},
+		{filelocker.PruneOptions{OlderThan: 14 * day, Name: "*.tgz"}, []string{"1", "2"}},
+		{filelocker.PruneOptions{OlderThan: 14 * day, Name: "*.tgz", KeepNewest: 2}, []string{"1"}},
+		{filelocker.PruneOptions{KeepNewest: 1}, []string{"1", "2"}},
+		{filelocker.PruneOptions{FailedAvScan: true}, []string{"4"}},
+		{filelocker.PruneOptions{LargerThan: 2 << 20}, []string{"1", "2", "3"}},
+	}
+
+	for _, test := range tests {
+		prune, err := filelocker.PlanPrune(files, test.opts, now)
+		if err != nil {
+			t.Errorf("error planning prune %+v: %s", test.opts, err)
+			continue
+		}
+
+		var ids []string
+		for _, f := range prune {
+			ids = append(ids, f.ID)
+		}
+
+		if strings.Join(ids, ",") != strings.Join(test.expected, ",") {
+			t.Errorf("expected %+v to prune %v, got %v", test.opts, test.expected, ids)
+		}
+	}
+
+	if _, err := filelocker.PlanPrune(files, filelocker.PruneOptions{}, now); err == nil {
+		t.Error("expected error without a selector, got nil")
+	}
+}
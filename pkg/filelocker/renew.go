@@ -0,0 +1,81 @@
+package filelocker
+
+import (
+	"errors"
+	"time"
+)
+
+// RenewOptions selects files to renew and how far to push out their expirations.  A file must
+// match all of the selectors that are set.
+type RenewOptions struct {
+	// ExpiringWithin selects files that expire within the duration
+	ExpiringWithin time.Duration
+
+	// OlderThan selects files uploaded more than the duration ago
+	OlderThan time.Duration
+
+	// Tags selects files with all of the tags in their metadata
+	Tags map[string]string
+
+	// Extend is how far from now to move the expiration, capped at Max
+	Extend time.Duration
+
+	// Max is the longest expiration to allow from now, zero means no limit
+	Max time.Duration
+}
+
+// Renewal is a planned change to a file's expiration
+type Renewal struct {
+	File File      `json:"file"`
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// PlanRenewals selects the files to renew and their new expirations.  Files whose expiration
+// can't be moved any later are left out.  Dates are in now's time zone, which should be the
+// client's DateLocation.
+func PlanRenewals(files []File, o RenewOptions, now time.Time) ([]Renewal, error) {
+	if o.ExpiringWithin <= 0 && o.OlderThan <= 0 {
+		return nil, errors.New("expiring within or older than must be set")
+	}
+
+	extend := o.Extend
+	if extend <= 0 || (o.Max > 0 && extend > o.Max) {
+		extend = o.Max
+	}
+
+	if extend <= 0 {
+		return nil, errors.New("extend or max must be set")
+	}
+
+	// filelocker expirations are dates, so round down to stay within the maximum
+	y, m, d := now.Add(extend).Date()
+	to := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+
+	var renewals []Renewal
+	for _, f := range files {
+		from, err := parseDateIn(f.Expiration, now.Location())
+		if err != nil {
+			continue
+		}
+
+		if o.ExpiringWithin > 0 && from.Sub(now) > o.ExpiringWithin {
+			continue
+		}
+
+		if o.OlderThan > 0 {
+			uploaded, err := parseDateIn(f.Uploaded, now.Location())
+			if err != nil || now.Sub(uploaded) < o.OlderThan {
+				continue
+			}
+		}
+
+		if !f.HasTags(o.Tags) || !to.After(from) {
+			continue
+		}
+
+		renewals = append(renewals, Renewal{File: f, From: from, To: to})
+	}
+
+	return renewals, nil
+}
@@ -0,0 +1,58 @@
+package filelocker_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/YaleUniversity/go-filelocker/pkg/filelocker"
+)
+
+func TestPlanRenewals(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.Local)
+	day := 24 * time.Hour
+
+	files := []filelocker.File{
+		{ID: "1", Expiration: "10/03/2026", Uploaded: "09/01/2026"},
+		{ID: "2", Expiration: "10/20/2026", Uploaded: "09/01/2026"},
+		{ID: "3", Expiration: "10/03/2026", Uploaded: "09/30/2026"},
+		{ID: "4", Expiration: "10/03/2026", Uploaded: "09/01/2026", Notes: "#filelocker project=finance"},
+		{ID: "5", Expiration: "10/31/2026", Uploaded: "09/01/2026"},
+	}
+
+	renewals, err := filelocker.PlanRenewals(files, filelocker.RenewOptions{ExpiringWithin: 7 * day, Max: 30 * day}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for _, r := range renewals {
+		ids = append(ids, r.File.ID)
+
+		if expected := time.Date(2026, 10, 31, 0, 0, 0, 0, time.Local); !r.To.Equal(expected) {
+			t.Errorf("expected file %s to be renewed to %s, got %s", r.File.ID, expected, r.To)
+		}
+	}
+
+	if len(ids) != 3 || ids[0] != "1" || ids[1] != "3" || ids[2] != "4" {
+		t.Errorf("expected files 1, 3 and 4 to be renewed, got %v", ids)
+	}
+
+	renewals, err = filelocker.PlanRenewals(files, filelocker.RenewOptions{
+		ExpiringWithin: 7 * day,
+		OlderThan:      7 * day,
+		Tags:           map[string]string{"project": "finance"},
+		Extend:         14 * day,
+		Max:            30 * day,
+	}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(renewals) != 1 || renewals[0].File.ID != "4" || !renewals[0].To.Equal(time.Date(2026, 10, 15, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("expected only file 4 to be renewed to 10/15/2026, got %+v", renewals)
+	}
+
+	if _, err := filelocker.PlanRenewals(files, filelocker.RenewOptions{Max: 30 * day}, now); err == nil {
+		t.Error("expected error without a selector, got nil")
+	}
+}
@@ -0,0 +1,194 @@
+package filelocker
+
+import (
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy retries calls that fail with a network error, like a timeout or a reset connection,
+// or a retryable status, like a bad gateway from a load balancer.  TLS, certificate and redirect
+// errors aren't retried.  Logging in and read-only calls, like Files, Groups and SecureMessages,
+// are retried automatically.  Calls that change something, like Delete and NewSecureMessage, are
+// only retried with RetryMutating since a failed attempt may have been applied by the server.
+// Uploads are streamed, so they're never retried.
+type RetryPolicy struct {
+	// MaxAttempts is the most times a call is tried, retries are disabled when it's less than 2
+	MaxAttempts int
+
+	// Backoff is the wait before the first retry, it doubles for each retry after that
+	Backoff time.Duration
+
+	// MaxBackoff caps the wait between attempts when it's set, including waits asked for with a
+	// Retry-After header
+	MaxBackoff time.Duration
+
+	// Jitter randomly lengthens or shortens each wait by up to this fraction of it, ie. 0.2 for
+	// up to 20%, so that clients that failed together don't retry together
+	Jitter float64
+
+	// RetryableStatuses are the response statuses that are retried, DefaultRetryableStatuses when empty
+	RetryableStatuses []int
+
+	// RetryMutating retries calls that change something in filelocker too
+	RetryMutating bool
+}
+
+// DefaultRetryableStatuses are the statuses retried when a policy doesn't set RetryableStatuses
+var DefaultRetryableStatuses = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// DefaultRetryPolicy is the retry policy of new clients
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	Backoff:     500 * time.Millisecond,
+	MaxBackoff:  10 * time.Second,
+	Jitter:      0.2,
+}
+
+// retryable reports whether a failed request can be tried again
+func (p RetryPolicy) retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return networkError(err)
+	}
+
+	statuses := p.RetryableStatuses
+	if len(statuses) == 0 {
+		statuses = DefaultRetryableStatuses
+	}
+
+	for _, s := range statuses {
+		if resp.StatusCode == s {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the wait before retrying after the attempt.  A Retry-After header on the
+// response is honoured over the policy's backoff, up to MaxBackoff.
+func (p RetryPolicy) backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if d, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			if p.MaxBackoff > 0 && d > p.MaxBackoff {
+				d = p.MaxBackoff
+			}
+			return d
+		}
+	}
+
+	d := float64(p.Backoff) * math.Pow(2, float64(attempt-1))
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	return time.Duration(d)
+}
+
+// networkError reports whether a request failed with a network error that may not happen again:
+// a timeout, a temporary error, or a connection that was reset or closed before the response
+func networkError(err error) bool {
+	if ue, ok := err.(*url.Error); ok {
+		err = ue.Err
+	}
+
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return true
+	}
+
+	if ne, ok := err.(net.Error); ok && (ne.Timeout() || ne.Temporary()) {
+		return true
+	}
+
+	if oe, ok := err.(*net.OpError); ok {
+		err = oe.Err
+	}
+
+	if se, ok := err.(*os.SyscallError); ok {
+		err = se.Err
+	}
+	return err == syscall.ECONNRESET
+}
+
+// retryAfter parses a Retry-After header, which is either a number of seconds or an HTTP date
+func retryAfter(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+
+	if s, err := strconv.Atoi(v); err == nil && s >= 0 {
+		return time.Duration(s) * time.Second, true
+	}
+
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+
+	if d := t.Sub(now); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
+
+// doIdempotent sends a read-only request to filelocker, retrying it with the client's retry policy
+func (c *Client) doIdempotent(req *http.Request) (*http.Response, error) {
+	hc, err := c.loggedIn(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	return c.sendRetry(hc, req)
+}
+
+// sendRetry sends a request with the HTTP client, retrying it with the client's retry policy
+func (c *Client) sendRetry(hc *http.Client, req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := c.send(hc, req)
+		// a body that can't be read again can't be resent
+		if attempt >= c.retry.MaxAttempts || (req.Body != nil && req.GetBody == nil) || !c.retry.retryable(resp, err) {
+			return resp, err
+		}
+
+		wait := c.retry.backoff(attempt, resp)
+		if resp != nil {
+			resp.Body.Close()
+			c.log().Warn("retrying filelocker request", "path", req.URL.Path, "attempt", attempt, "status", resp.Status, "wait", wait)
+		} else {
+			c.log().Warn("retrying filelocker request", "path", req.URL.Path, "attempt", attempt, "error", err, "wait", wait)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+
+		// the request is sent again with a fresh copy of its body
+		next := req.WithContext(req.Context())
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			next.Body = body
+		}
+		req = next
+	}
+}
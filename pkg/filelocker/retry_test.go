@@ -0,0 +1,294 @@
+package filelocker_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/YaleUniversity/go-filelocker/pkg/filelocker"
+)
+
+// flakyServer fails the first calls to path with the status and a Retry-After header, and counts
+// the calls and the subjects of the messages sent
+func flakyServer(t *testing.T, path string, failures, status int, retryAfter string, calls *int, subjects *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/cli/CLI_login" {
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte(loginResp))
+			return
+		}
+
+		if r.URL.Path != path {
+			t.Errorf("unexpected url %s", r.URL)
+			return
+		}
+
+		*calls++
+		if r.FormValue("subject") != "" {
+			*subjects = append(*subjects, r.FormValue("subject"))
+		}
+
+		if *calls <= failures {
+			w.Header().Set("Retry-After", retryAfter)
+			w.WriteHeader(status)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data": 1, "sMessages": [], "fMessages": []}`))
+	}))
+}
+
+func TestRetryIdempotent(t *testing.T) {
+	var calls int
+	var subjects []string
+	fl := flakyServer(t, "/message/get_new_message_count", 2, http.StatusServiceUnavailable, "0", &calls, &subjects)
+	defer fl.Close()
+
+	// the Retry-After header is honoured over the hour long backoff
+	client, err := filelocker.NewClient(testUser, testKey, fl.URL, nil,
+		filelocker.WithRetryPolicy(filelocker.RetryPolicy{MaxAttempts: 3, Backoff: time.Hour, Jitter: 0.5}))
+	if err != nil {
+		t.Fatal("error creating new filelocker client:", err)
+	}
+
+	if _, err := client.SecureMessagesCount(); err != nil {
+		t.Fatal("expected message count after retries, got", err)
+	}
+
+	if calls != 3 {
+		t.Errorf("expected 3 attempts, got %d", calls)
+	}
+}
+
+func TestRetryLogin(t *testing.T) {
+	var logins int
+	fl := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/cli/CLI_login" {
+			t.Errorf("unexpected url %s", r.URL)
+			return
+		}
+
+		logins++
+		if logins == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("CLIkey") != testKey {
+			t.Errorf("expected the login form to be sent again, got %v (%v)", r.PostForm, err)
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write([]byte(loginResp))
+	}))
+	defer fl.Close()
+
+	client, err := filelocker.NewClient(testUser, testKey, fl.URL, nil,
+		filelocker.WithRetryPolicy(filelocker.RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond}))
+	if err != nil {
+		t.Fatal("expected login after a retry, got", err)
+	}
+
+	if logins != 2 || client.Origin != "123requestorigin321" {
+		t.Errorf("expected to log in on the second attempt, got %d attempts with origin %q", logins, client.Origin)
+	}
+}
+
+func TestRetryExhausted(t *testing.T) {
+	var calls int
+	var subjects []string
+	fl := flakyServer(t, "/message/get_new_message_count", 5, http.StatusBadGateway, "0", &calls, &subjects)
+	defer fl.Close()
+
+	client, err := filelocker.NewClient(testUser, testKey, fl.URL, nil,
+		filelocker.WithRetryPolicy(filelocker.RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond}))
+	if err != nil {
+		t.Fatal("error creating new filelocker client:", err)
+	}
+
+	if _, err := client.SecureMessagesCount(); err == nil {
+		t.Error("expected error after the attempts ran out")
+	}
+
+	if calls != 2 {
+		t.Errorf("expected 2 attempts, got %d", calls)
+	}
+}
+
+func TestRetryStatuses(t *testing.T) {
+	var calls int
+	var subjects []string
+	fl := flakyServer(t, "/message/get_new_message_count", 1, http.StatusInternalServerError, "0", &calls, &subjects)
+	defer fl.Close()
+
+	client, err := filelocker.NewClient(testUser, testKey, fl.URL, nil,
+		filelocker.WithRetryPolicy(filelocker.RetryPolicy{MaxAttempts: 2, RetryableStatuses: []int{http.StatusInternalServerError}}))
+	if err != nil {
+		t.Fatal("error creating new filelocker client:", err)
+	}
+
+	if _, err := client.SecureMessagesCount(); err != nil {
+		t.Fatal("expected message count after retrying a 500, got", err)
+	}
+
+	if calls != 2 {
+		t.Errorf("expected 2 attempts, got %d", calls)
+	}
+}
+
+func TestRetryMutating(t *testing.T) {
+	for _, mutating := range []bool{false, true} {
+		var calls int
+		var subjects []string
+		fl := flakyServer(t, "/message/create_message", 1, http.StatusBadGateway, "0", &calls, &subjects)
+
+		client, err := filelocker.NewClient(testUser, testKey, fl.URL, nil,
+			filelocker.WithRetryPolicy(filelocker.RetryPolicy{MaxAttempts: 3, RetryMutating: mutating}))
+		if err != nil {
+			t.Fatal("error creating new filelocker client:", err)
+		}
+
+		_, err = client.NewSecureMessage("shh", "secret", []string{"user1"}, time.Now())
+		fl.Close()
+
+		if !mutating {
+			if err == nil || calls != 1 {
+				t.Errorf("expected a single failed attempt without RetryMutating, got %d attempts, error %v", calls, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Error("expected message to be sent after a retry, got", err)
+		}
+
+		if len(subjects) != 2 || subjects[1] != "shh" {
+			t.Errorf("expected the form to be sent again, got subjects %v", subjects)
+		}
+	}
+}
+
+func TestRetryAfterMaxBackoff(t *testing.T) {
+	var calls int
+	var subjects []string
+	fl := flakyServer(t, "/message/get_new_message_count", 1, http.StatusServiceUnavailable, "3600", &calls, &subjects)
+	defer fl.Close()
+
+	client, err := filelocker.NewClient(testUser, testKey, fl.URL, nil,
+		filelocker.WithRetryPolicy(filelocker.RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}))
+	if err != nil {
+		t.Fatal("error creating new filelocker client:", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := client.SecureMessagesCount()
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal("expected message count after a retry, got", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the hour long Retry-After to be capped by MaxBackoff")
+	}
+
+	if calls != 2 {
+		t.Errorf("expected 2 attempts, got %d", calls)
+	}
+}
+
+func TestRetryNetworkErrors(t *testing.T) {
+	policy := filelocker.WithRetryPolicy(filelocker.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond})
+
+	// a connection dropped before the response is retried
+	var calls int
+	fl := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn.Close()
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data": 1, "sMessages": [], "fMessages": []}`))
+	}))
+	defer fl.Close()
+
+	client, err := filelocker.New(fl.URL, policy)
+	if err != nil {
+		t.Fatal("error creating new filelocker client:", err)
+	}
+
+	if _, err := client.SecureMessagesCount(); err != nil {
+		t.Fatal("expected message count after a dropped connection, got", err)
+	}
+
+	if calls != 2 {
+		t.Errorf("expected 2 attempts, got %d", calls)
+	}
+
+	// an untrusted certificate isn't retried
+	var conns int32
+	tlsServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("expected the TLS handshake to fail")
+	}))
+	tlsServer.Config.ConnState = func(c net.Conn, s http.ConnState) {
+		if s == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	tlsServer.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	tlsServer.StartTLS()
+	defer tlsServer.Close()
+
+	client, err = filelocker.New(tlsServer.URL, policy, filelocker.WithHTTPClient(&http.Client{}))
+	if err != nil {
+		t.Fatal("error creating new filelocker client:", err)
+	}
+
+	if _, err := client.SecureMessagesCount(); err == nil {
+		t.Error("expected certificate error")
+	}
+
+	if n := atomic.LoadInt32(&conns); n != 1 {
+		t.Errorf("expected 1 connection for a certificate error, got %d", n)
+	}
+
+	// a redirect refused by the HTTP client isn't retried
+	var redirects int
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirects++
+		http.Redirect(w, r, "/elsewhere", http.StatusFound)
+	}))
+	defer redirect.Close()
+
+	noRedirects := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return errors.New("redirects aren't followed")
+	}}
+
+	client, err = filelocker.New(redirect.URL, policy, filelocker.WithHTTPClient(noRedirects))
+	if err != nil {
+		t.Fatal("error creating new filelocker client:", err)
+	}
+
+	if _, err := client.SecureMessagesCount(); err == nil {
+		t.Error("expected redirect error")
+	}
+
+	if redirects != 1 {
+		t.Errorf("expected 1 attempt for a redirect error, got %d", redirects)
+	}
+}
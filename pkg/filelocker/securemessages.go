@@ -1,6 +1,7 @@
 package filelocker
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,6 +13,9 @@ import (
 	"time"
 )
 
+// MaxMessageSize is the largest secure message body, in bytes, filelocker accepts
+const MaxMessageSize = 65536
+
 // SecureMessage is an encrypted message sent through filelocker
 type SecureMessage struct {
 	Body       string   `json:"body"`
@@ -22,6 +26,9 @@ type SecureMessage struct {
 	Recipients []string `json:"messageRecipients"`
 	Subject    string   `json:"subject"`
 	Viewed     string   `json:"viewedDatetime"`
+
+	// PGP is set when the body was protected with OpenPGP and the client has PGP configured
+	PGP *PGPStatus `json:"pgp,omitempty"`
 }
 
 // SecureMessagesResponse is the response for the list of secure messages
@@ -31,6 +38,36 @@ type SecureMessagesResponse struct {
 	InfoMessages  []string          `json:"sMessages"`
 }
 
+// Received returns the messages sent to the user.  Filelocker returns received
+// messages as the first list in the response data.
+func (r *SecureMessagesResponse) Received() []SecureMessage {
+	if len(r.Messages) < 1 {
+		return nil
+	}
+	return r.Messages[0]
+}
+
+// Sent returns the messages the user has sent.  Filelocker returns sent messages
+// as the second list in the response data.
+func (r *SecureMessagesResponse) Sent() []SecureMessage {
+	if len(r.Messages) < 2 {
+		return nil
+	}
+	return r.Messages[1]
+}
+
+// Message finds a sent or received message by ID
+func (r *SecureMessagesResponse) Message(id int) (*SecureMessage, bool) {
+	for _, list := range r.Messages {
+		for _, m := range list {
+			if m.ID == id {
+				return &m, true
+			}
+		}
+	}
+	return nil, false
+}
+
 // SecureMessages gets the list of messages for a user
 func (c *Client) SecureMessages() (*SecureMessagesResponse, error) {
 	url := fmt.Sprintf("%s/message/get_messages", c.BaseURL)
@@ -42,13 +79,13 @@ func (c *Client) SecureMessages() (*SecureMessagesResponse, error) {
 	req.Header.Add("Content-Type", defaultContentTypeHeader)
 	req.Header.Add("Accept", "application/json")
 
-	resp, err := c.Client.Do(req)
+	resp, err := c.doIdempotent(req)
 	if err != nil {
 		return nil, err
 	}
 	defer func() {
 		if e := resp.Body.Close(); e != nil {
-			// TODO: log event
+			c.log().Warn("error closing filelocker response", "error", e)
 		}
 	}()
 
@@ -64,9 +101,18 @@ func (c *Client) SecureMessages() (*SecureMessagesResponse, error) {
 	}
 
 	if len(v.ErrorMessages) > 0 {
+		c.log().Error("error listing secure messages", "errors", v.ErrorMessages)
 		return nil, errors.New("error listing secure messages")
 	}
 
+	if c.PGP != nil {
+		for i := range v.Messages {
+			for j := range v.Messages[i] {
+				c.PGP.open(&v.Messages[i][j])
+			}
+		}
+	}
+
 	return &v, nil
 }
 
@@ -90,13 +136,13 @@ func (c *Client) SecureMessageRead(id int) (*SecureMessageReadResponse, error) {
 	req.Header.Add("Content-Type", defaultContentTypeHeader)
 	req.Header.Add("Accept", "application/json")
 
-	resp, err := c.Client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer func() {
 		if e := resp.Body.Close(); e != nil {
-			// TODO: log event
+			c.log().Warn("error closing filelocker response", "error", e)
 		}
 	}()
 
@@ -112,6 +158,7 @@ func (c *Client) SecureMessageRead(id int) (*SecureMessageReadResponse, error) {
 	}
 
 	if len(v.ErrorMessages) > 0 {
+		c.log().Error("error marking secure message as read", "errors", v.ErrorMessages)
 		return nil, errors.New("error marking secure message as read")
 	}
 
@@ -136,13 +183,13 @@ func (c *Client) SecureMessagesCount() (*SecureMessageCountResponse, error) {
 	req.Header.Add("Content-Type", defaultContentTypeHeader)
 	req.Header.Add("Accept", "application/json")
 
-	resp, err := c.Client.Do(req)
+	resp, err := c.doIdempotent(req)
 	if err != nil {
 		return nil, err
 	}
 	defer func() {
 		if e := resp.Body.Close(); e != nil {
-			// TODO: log event
+			c.log().Warn("error closing filelocker response", "error", e)
 		}
 	}()
 
@@ -158,6 +205,7 @@ func (c *Client) SecureMessagesCount() (*SecureMessageCountResponse, error) {
 	}
 
 	if len(v.ErrorMessages) > 0 {
+		c.log().Error("error listing secure messages", "errors", v.ErrorMessages)
 		return nil, errors.New("error listing secure messages")
 	}
 
@@ -180,11 +228,28 @@ func (c *Client) NewSecureMessage(subject, msg string, recipients []string, expi
 		return nil, errors.New("a list of recipients is required")
 	}
 
+	if c.PGP != nil && (c.PGP.Encrypt || c.PGP.Signer != nil) {
+		sealed, err := c.PGP.seal(msg, recipients)
+		if err != nil {
+			return nil, err
+		}
+		msg = sealed
+	}
+
+	if len(msg) > MaxMessageSize {
+		return nil, fmt.Errorf("message body is %d bytes, larger than the maximum of %d", len(msg), MaxMessageSize)
+	}
+
+	origin, err := c.requestOrigin()
+	if err != nil {
+		return nil, err
+	}
+
 	form := url.Values{}
-	form.Add("requestOrigin", c.Origin)
+	form.Add("requestOrigin", origin)
 	form.Add("subject", subject)
 	form.Add("body", msg)
-	form.Add("expiration", expire.Format("01/02/2006"))
+	form.Add("expiration", c.formatDate(expire))
 
 	recipientIds := strings.Join(recipients, ",")
 	form.Add("recipientIds", recipientIds)
@@ -198,13 +263,13 @@ func (c *Client) NewSecureMessage(subject, msg string, recipients []string, expi
 	req.Header.Add("Content-Type", defaultContentTypeHeader)
 	req.Header.Add("Accept", "application/json")
 
-	resp, err := c.Client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer func() {
 		if e := resp.Body.Close(); e != nil {
-			// TODO: log event
+			c.log().Warn("error closing filelocker response", "error", e)
 		}
 	}()
 
@@ -220,6 +285,7 @@ func (c *Client) NewSecureMessage(subject, msg string, recipients []string, expi
 	}
 
 	if len(v.ErrorMessages) > 0 {
+		c.log().Error("error sending secure messages", "errors", v.ErrorMessages)
 		return nil, errors.New("error sending secure messages")
 	}
 
@@ -239,9 +305,14 @@ func (c *Client) SecureMessagesDelete(ids []int) (*SecureMessagesDeleteResponse,
 		idList = append(idList, strconv.Itoa(i))
 	}
 
+	origin, err := c.requestOrigin()
+	if err != nil {
+		return nil, err
+	}
+
 	form := url.Values{}
 	form.Add("messageIds", strings.Join(idList, ","))
-	form.Add("requestOrigin", c.Origin)
+	form.Add("requestOrigin", origin)
 
 	url := fmt.Sprintf("%s/message/delete_messages", c.BaseURL)
 	req, err := http.NewRequest("POST", url, strings.NewReader(form.Encode()))
@@ -252,13 +323,13 @@ func (c *Client) SecureMessagesDelete(ids []int) (*SecureMessagesDeleteResponse,
 	req.Header.Add("Content-Type", defaultContentTypeHeader)
 	req.Header.Add("Accept", "application/json")
 
-	resp, err := c.Client.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer func() {
 		if e := resp.Body.Close(); e != nil {
-			// TODO: log event
+			c.log().Warn("error closing filelocker response", "error", e)
 		}
 	}()
 
@@ -274,8 +345,40 @@ func (c *Client) SecureMessagesDelete(ids []int) (*SecureMessagesDeleteResponse,
 	}
 
 	if len(v.ErrorMessages) > 0 {
+		c.log().Error("error deleting secure messages", "errors", v.ErrorMessages)
 		return nil, errors.New("error deleting secure messages")
 	}
 
 	return &v, nil
 }
+
+// WaitForFirstView polls filelocker every interval until the message has been viewed or the
+// context is done.  Filelocker keeps a single viewed date for a message, set when the first
+// recipient views it, so a message sent to several recipients is returned once any of them has
+// viewed it.  The viewed message is returned, otherwise the context error is returned.
+func (c *Client) WaitForFirstView(ctx context.Context, id int, interval time.Duration) (*SecureMessage, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		resp, err := c.SecureMessages()
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := resp.Message(id)
+		if !ok {
+			return nil, fmt.Errorf("secure message %d not found", id)
+		}
+
+		if m.Viewed != "" {
+			return m, nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
@@ -1,11 +1,13 @@
 package filelocker_test
 
 import (
+	"context"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -452,3 +454,62 @@ func TestNewSecureMessagesError(t *testing.T) {
 		t.Error("expected secure messages delete error, got nil")
 	}
 }
+
+func TestWaitForFirstView(t *testing.T) {
+	messages := []string{
+		`{"sMessages": [], "fMessages": [], "data": [[], [{"id": 5, "ownerId": "testuser", "subject": "sent", "viewedDatetime": null}]]}`,
+		`{"sMessages": [], "fMessages": [], "data": [[], [{"id": 5, "ownerId": "testuser", "subject": "sent", "viewedDatetime": "06/11/2018"}]]}`,
+	}
+
+	var polls int
+	fl := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.String() != "/message/get_messages" {
+			t.Errorf("got url %s, expected '/message/get_messages'", r.URL)
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(messages[polls]))
+		polls++
+	}))
+	defer fl.Close()
+
+	bURL, err := url.Parse(fl.URL)
+	if err != nil {
+		t.Error(err)
+	}
+
+	client := filelocker.Client{
+		Client:  http.DefaultClient,
+		Origin:  "123requestorigin321",
+		BaseURL: bURL,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	m, err := client.WaitForFirstView(ctx, 5, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal("error waiting for secure message to be viewed", err)
+	}
+
+	if m.Viewed != "06/11/2018" {
+		t.Errorf("expected viewed date '06/11/2018', got %s", m.Viewed)
+	}
+
+	if polls != 2 {
+		t.Errorf("expected 2 polls, got %d", polls)
+	}
+}
+
+func TestNewSecureMessageTooLarge(t *testing.T) {
+	client := filelocker.Client{
+		Client: http.DefaultClient,
+		Origin: "123requestorigin321",
+	}
+
+	body := strings.Repeat("x", filelocker.MaxMessageSize+1)
+	_, err := client.NewSecureMessage("test test", body, []string{"user1"}, time.Now())
+	if err == nil {
+		t.Error("expected message too large error, got nil")
+	}
+}
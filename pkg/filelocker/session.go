@@ -0,0 +1,51 @@
+package filelocker
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+)
+
+// Session is an authenticated filelocker session that can be saved and resumed later to avoid
+// logging in again
+type Session struct {
+	Origin  string         `json:"origin"`
+	Cookies []*http.Cookie `json:"cookies"`
+}
+
+// Session returns the client's current session
+func (c *Client) Session() Session {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := Session{Origin: c.Origin}
+	if c.Client != nil && c.Client.Jar != nil {
+		s.Cookies = c.Client.Jar.Cookies(c.BaseURL)
+	}
+	return s
+}
+
+// SetSession resumes a saved session.  It doesn't check the session is still valid.
+func (c *Client) SetSession(s Session) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Client == nil {
+		c.Client = http.DefaultClient
+	}
+
+	if c.Client.Jar == nil {
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			return err
+		}
+
+		// don't add a cookie jar to http.DefaultClient
+		client := *c.Client
+		client.Jar = jar
+		c.Client = &client
+	}
+
+	c.Client.Jar.SetCookies(c.BaseURL, s.Cookies)
+	c.Origin = s.Origin
+	return nil
+}
@@ -0,0 +1,214 @@
+package filelocker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxTraceBody is the most of a response body, in bytes, written to a trace
+const maxTraceBody = 64 * 1024
+
+// tracer writes the requests and responses of a client, with the secrets redacted
+type tracer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// secretHeaders are the headers that are redacted from traces
+var secretHeaders = map[string]bool{
+	"Authorization": true,
+	"Cookie":        true,
+	"Set-Cookie":    true,
+}
+
+// loginOrigin matches the request origin returned when logging in
+var loginOrigin = regexp.MustCompile(`(?s)<info>.*?</info>`)
+
+// redactHeader returns a copy of headers with the secrets redacted
+func redactHeader(h http.Header) http.Header {
+	r := make(http.Header, len(h))
+	for k, vals := range h {
+		if secretHeaders[http.CanonicalHeaderKey(k)] {
+			vals = []string{redacted}
+		}
+		r[k] = vals
+	}
+	return r
+}
+
+// redactJSON redacts message bodies from a JSON response, it returns false if the JSON can't be parsed
+func redactJSON(data []byte) ([]byte, bool) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, false
+	}
+
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, e := range v {
+				if secretFields[k] {
+					v[k] = redacted
+					continue
+				}
+				walk(e)
+			}
+		case []interface{}:
+			for _, e := range v {
+				walk(e)
+			}
+		}
+	}
+	walk(v)
+
+	out, err := json.Marshal(v)
+	if err != nil {
+		return nil, false
+	}
+	return out, true
+}
+
+// writeHeader writes headers, sorted and redacted, with each line prefixed
+func writeHeader(b *bytes.Buffer, prefix string, h http.Header) {
+	h = redactHeader(h)
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		for _, v := range h[k] {
+			fmt.Fprintf(b, "%s %s: %s\n", prefix, k, v)
+		}
+	}
+	fmt.Fprintln(b, prefix)
+}
+
+// request writes the request line, headers and form fields of a request
+func (t *tracer) request(req *http.Request) {
+	b := &bytes.Buffer{}
+
+	u := *req.URL
+	u.RawQuery = redactValues(req.URL.Query()).Encode()
+	fmt.Fprintf(b, "> %s %s\n", req.Method, u.RequestURI())
+	writeHeader(b, ">", req.Header)
+
+	switch {
+	case req.Body == nil || req.ContentLength == 0:
+	case req.Header.Get("Content-Type") == defaultContentTypeHeader && req.GetBody != nil:
+		form, err := formBody(req)
+		if err != nil {
+			fmt.Fprintf(b, "> [form unreadable: %s]\n", err)
+			break
+		}
+		fmt.Fprintf(b, "> %s\n", redactValues(form).Encode())
+	case req.ContentLength > 0:
+		fmt.Fprintf(b, "> [%d bytes of %s]\n", req.ContentLength, req.Header.Get("Content-Type"))
+	default:
+		fmt.Fprintf(b, "> [streamed %s]\n", req.Header.Get("Content-Type"))
+	}
+
+	t.write(b)
+}
+
+// formBody reads a copy of a request's form fields
+func formBody(req *http.Request) (url.Values, error) {
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	return url.ParseQuery(string(data))
+}
+
+// response writes the status, headers and text body of a response.  The start of the body is read
+// to write it and put back for the caller.
+func (t *tracer) response(req *http.Request, resp *http.Response, d time.Duration) {
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "< %s %s (%s)\n", resp.Proto, resp.Status, d)
+	writeHeader(b, "<", resp.Header)
+
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch {
+	case strings.HasSuffix(req.URL.Path, "/file/download"):
+		fmt.Fprintln(b, "< [file contents omitted]")
+	case strings.Contains(contentType, "json"), strings.Contains(contentType, "xml"), strings.HasPrefix(contentType, "text/"):
+		// JSON is redacted whatever it's labelled as, since filelocker doesn't always label it
+		data := peekBody(resp)
+		if out, ok := redactJSON(data); ok {
+			fmt.Fprintf(b, "< %s\n", out)
+			break
+		}
+
+		if trimmed := bytes.TrimSpace(data); strings.Contains(contentType, "json") || bytes.HasPrefix(trimmed, []byte("{")) || bytes.HasPrefix(trimmed, []byte("[")) {
+			fmt.Fprintf(b, "< [%d bytes of json omitted, it can't be redacted]\n", len(data))
+			break
+		}
+
+		if strings.HasSuffix(req.URL.Path, "/cli/CLI_login") {
+			data = loginOrigin.ReplaceAll(data, []byte("<info>"+redacted+"</info>"))
+		}
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			fmt.Fprintf(b, "< %s\n", strings.TrimRight(line, "\r"))
+		}
+	case contentType == "":
+		fmt.Fprintln(b, "< [body omitted]")
+	default:
+		fmt.Fprintf(b, "< [%s body omitted]\n", contentType)
+	}
+
+	t.write(b)
+}
+
+// peekBody reads up to maxTraceBody bytes of a response body and puts them back
+func peekBody(resp *http.Response) []byte {
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxTraceBody))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(data), errReader{err}, resp.Body), resp.Body}
+	return data
+}
+
+// errReader returns an error from Read, or EOF when the error is nil
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	return 0, io.EOF
+}
+
+// failure writes a request that failed without a response
+func (t *tracer) failure(err error, d time.Duration) {
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "< error after %s: %s\n", d, err)
+	t.write(b)
+}
+
+func (t *tracer) write(b *bytes.Buffer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b.WriteString("\n")
+	t.w.Write(b.Bytes())
+}
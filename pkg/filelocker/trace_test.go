@@ -0,0 +1,140 @@
+package filelocker_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/YaleUniversity/go-filelocker/pkg/filelocker"
+)
+
+func TestTrace(t *testing.T) {
+	fl := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cli/CLI_login":
+			w.Header().Set("Content-Type", "application/xml")
+			w.Header().Set("Set-Cookie", loginCookie)
+			w.Write([]byte(loginResp))
+		case "/message/get_messages":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"data": [[{"id": 1, "subject": "hi", "body": "the launch codes"}], []], "sMessages": [], "fMessages": []}`))
+		case "/message/create_message":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"sMessages": ["sent"], "fMessages": []}`))
+		case "/file/get_user_file_list", "/file/get_files_shared_with_user":
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte(`<cli_response><messages/><data/></cli_response>`))
+		case "/file/download":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("the launch codes"))
+		case "/file/upload":
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte(`<cli_response><messages><info>uploaded</info></messages><data><file id="42"/></data></cli_response>`))
+		case "/file/update_file":
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte(`<cli_response><messages><info>updated</info></messages></cli_response>`))
+		default:
+			t.Errorf("unexpected url %s", r.URL)
+		}
+	}))
+	defer fl.Close()
+
+	var trace bytes.Buffer
+	client, err := filelocker.NewClient(testUser, testKey, fl.URL, nil, filelocker.WithTrace(&trace))
+	if err != nil {
+		t.Fatal("error creating new filelocker client:", err)
+	}
+
+	msgs, err := client.SecureMessages()
+	if err != nil {
+		t.Fatal("error listing secure messages:", err)
+	}
+
+	if len(msgs.Received()) != 1 || msgs.Received()[0].Body != "the launch codes" {
+		t.Errorf("expected the traced response to be read in full, got %+v", msgs.Received())
+	}
+
+	if _, err := client.NewSecureMessage("shh", "the launch codes", []string{"user1"}, time.Now()); err != nil {
+		t.Fatal("error sending secure message:", err)
+	}
+
+	if _, err := client.Upload("codes.txt", "", false, strings.NewReader("the launch codes")); err != nil {
+		t.Fatal("error uploading:", err)
+	}
+
+	var download bytes.Buffer
+	if _, err := client.Download("42", &download); err != nil {
+		t.Fatal("error downloading:", err)
+	}
+
+	if download.String() != "the launch codes" {
+		t.Errorf("expected the traced download to be read in full, got %q", download.String())
+	}
+
+	out := trace.String()
+	for _, expected := range []string{
+		"> POST /cli/CLI_login\n",
+		"> CLIkey=%5BREDACTED%5D&userId=testuser\n",
+		"< HTTP/1.1 200 OK (",
+		"< Set-Cookie: [REDACTED]\n",
+		"<info>[REDACTED]</info>",
+		`"subject":"hi"`,
+		"&subject=shh\n",
+		"> POST /file/upload?fileName=codes.txt",
+		"> [streamed application/octet-stream]\n",
+		"> GET /file/download?fileId=42\n",
+		"< [file contents omitted]\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected trace to contain %q, got\n%s", expected, out)
+		}
+	}
+
+	for _, secret := range []string{testKey, "123requestorigin321", "123sessiontoken321", "the launch codes"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("expected %q to be redacted from the trace\n%s", secret, out)
+		}
+	}
+}
+
+func TestTraceMislabelledJSON(t *testing.T) {
+	fl := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		switch r.URL.Path {
+		case "/message/get_messages":
+			w.Write([]byte(`{"data": [[{"id": 1, "subject": "hi", "body": "the launch codes"}], []], "sMessages": [], "fMessages": []}`))
+		case "/message/get_new_message_count":
+			// cut off JSON can't be redacted, so it's left out
+			w.Write([]byte(`{"data": [[{"id": 1, "body": "the launch codes"`))
+		default:
+			t.Errorf("unexpected url %s", r.URL)
+		}
+	}))
+	defer fl.Close()
+
+	var trace bytes.Buffer
+	client, err := filelocker.New(fl.URL, filelocker.WithTrace(&trace))
+	if err != nil {
+		t.Fatal("error creating new filelocker client:", err)
+	}
+
+	if _, err := client.SecureMessages(); err != nil {
+		t.Fatal("error listing secure messages:", err)
+	}
+
+	if _, err := client.SecureMessagesCount(); err == nil {
+		t.Error("expected error reading cut off JSON")
+	}
+
+	out := trace.String()
+	if !strings.Contains(out, `"body":"[REDACTED]"`) || !strings.Contains(out, "< [47 bytes of json omitted, it can't be redacted]\n") {
+		t.Errorf("expected message bodies to be redacted from text/plain JSON, got\n%s", out)
+	}
+
+	if strings.Contains(out, "the launch codes") {
+		t.Errorf("expected the message body to be redacted from the trace\n%s", out)
+	}
+}
@@ -0,0 +1,173 @@
+package filelocker
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// EventMessageReceived is emitted when a new secure message arrives
+	EventMessageReceived = "message.received"
+	// EventMessageViewed is emitted when a sent secure message is viewed
+	EventMessageViewed = "message.viewed"
+	// EventFileShared is emitted when a file is newly shared with the user
+	EventFileShared = "file.shared"
+	// EventFileExpiring is emitted once when an owned file is about to expire
+	EventFileExpiring = "file.expiring"
+)
+
+// Event is a change in filelocker observed by a Watcher
+type Event struct {
+	Type    string
+	Time    time.Time
+	Message *SecureMessage
+	File    *File
+}
+
+// Watcher polls filelocker for new secure messages and newly shared files.  The first
+// poll records what already exists and only later polls emit events, unless Backfill is set.
+//
+// When Viewed is set, sent messages are also watched for being viewed.  When ExpiringWithin
+// is set, owned files are watched and reported once when they are within that long of their
+// expiration, including on the first poll.
+type Watcher struct {
+	Client         *Client
+	Interval       time.Duration
+	Backfill       bool
+	Viewed         bool
+	ExpiringWithin time.Duration
+
+	// OnError is called when a poll fails.  If it is nil, Watch stops and returns the error.
+	OnError func(error)
+
+	primed   bool
+	messages map[int]bool
+	viewed   map[int]bool
+	files    map[string]bool
+	expiring map[string]bool
+}
+
+// Poll checks filelocker once and returns any events since the last poll
+func (w *Watcher) Poll() ([]Event, error) {
+	if w.messages == nil {
+		w.messages = make(map[int]bool)
+		w.viewed = make(map[int]bool)
+		w.files = make(map[string]bool)
+		w.expiring = make(map[string]bool)
+	}
+
+	msgs, err := w.Client.SecureMessages()
+	if err != nil {
+		return nil, err
+	}
+
+	shared, err := w.Client.SharedFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	var owned *FilesResponse
+	if w.ExpiringWithin > 0 {
+		owned, err = w.Client.Files()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	emit := w.primed || w.Backfill
+	now := time.Now()
+
+	var events []Event
+	for _, m := range msgs.Received() {
+		if w.messages[m.ID] {
+			continue
+		}
+		w.messages[m.ID] = true
+
+		if emit {
+			m := m
+			events = append(events, Event{Type: EventMessageReceived, Time: now, Message: &m})
+		}
+	}
+
+	if w.Viewed {
+		for _, m := range msgs.Sent() {
+			if m.Viewed == "" || w.viewed[m.ID] {
+				continue
+			}
+			w.viewed[m.ID] = true
+
+			if emit {
+				m := m
+				events = append(events, Event{Type: EventMessageViewed, Time: now, Message: &m})
+			}
+		}
+	}
+
+	for _, f := range shared.Files {
+		if w.files[f.ID] {
+			continue
+		}
+		w.files[f.ID] = true
+
+		if emit {
+			f := f
+			events = append(events, Event{Type: EventFileShared, Time: now, File: &f})
+		}
+	}
+
+	if owned != nil {
+		for _, f := range owned.Files {
+			if w.expiring[f.ID] {
+				continue
+			}
+
+			expiration, err := w.Client.parseDate(f.Expiration)
+			if err != nil || expiration.Sub(now) > w.ExpiringWithin {
+				continue
+			}
+			w.expiring[f.ID] = true
+
+			f := f
+			events = append(events, Event{Type: EventFileExpiring, Time: now, File: &f})
+		}
+	}
+
+	w.primed = true
+	return events, nil
+}
+
+// Watch polls filelocker every Interval and sends events on the channel until the context is done
+func (w *Watcher) Watch(ctx context.Context, events chan<- Event) error {
+	interval := w.Interval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		evs, err := w.Poll()
+		if err != nil {
+			if w.OnError == nil {
+				return err
+			}
+			w.OnError(err)
+		}
+
+		for _, e := range evs {
+			select {
+			case events <- e:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
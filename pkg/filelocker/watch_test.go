@@ -0,0 +1,143 @@
+package filelocker_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/YaleUniversity/go-filelocker/pkg/filelocker"
+)
+
+func TestWatcherPoll(t *testing.T) {
+	messages := []string{
+		`{"sMessages": [], "fMessages": [], "data": [[{"id": 1, "ownerId": "bossman", "subject": "old"}], []]}`,
+		`{"sMessages": [], "fMessages": [], "data": [[{"id": 1, "ownerId": "bossman", "subject": "old"}, {"id": 2, "ownerId": "bossman", "subject": "new"}], []]}`,
+	}
+
+	files := []string{
+		`<?xml version="1.0"?><cli_response><messages></messages><data><file id="10" name="old.txt" ownerId="peon1"/></data></cli_response>`,
+		`<?xml version="1.0"?><cli_response><messages></messages><data><file id="10" name="old.txt" ownerId="peon1"/><file id="11" name="new.txt" ownerId="peon2"/></data></cli_response>`,
+	}
+
+	var messagesPolls, filesPolls int
+	fl := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.String() {
+		case "/message/get_messages":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(messages[messagesPolls]))
+			messagesPolls++
+		case "/file/get_files_shared_with_user":
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte(files[filesPolls]))
+			filesPolls++
+		default:
+			t.Errorf("unexpected url %s", r.URL)
+		}
+	}))
+	defer fl.Close()
+
+	bURL, err := url.Parse(fl.URL)
+	if err != nil {
+		t.Error(err)
+	}
+
+	client := filelocker.Client{
+		Client:  http.DefaultClient,
+		Origin:  "123requestorigin321",
+		BaseURL: bURL,
+	}
+
+	watcher := filelocker.Watcher{Client: &client}
+
+	events, err := watcher.Poll()
+	if err != nil {
+		t.Fatal("error polling filelocker", err)
+	}
+
+	if len(events) != 0 {
+		t.Errorf("expected no events from the first poll, got %+v", events)
+	}
+
+	events, err = watcher.Poll()
+	if err != nil {
+		t.Fatal("error polling filelocker", err)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %+v", events)
+	}
+
+	if events[0].Type != filelocker.EventMessageReceived || events[0].Message.ID != 2 {
+		t.Errorf("expected message.received event for message 2, got %+v", events[0])
+	}
+
+	if events[1].Type != filelocker.EventFileShared || events[1].File.ID != "11" {
+		t.Errorf("expected file.shared event for file 11, got %+v", events[1])
+	}
+}
+
+func TestWatcherViewedAndExpiring(t *testing.T) {
+	messages := []string{
+		`{"sMessages": [], "fMessages": [], "data": [[], [{"id": 5, "ownerId": "testuser", "subject": "sent", "viewedDatetime": null}]]}`,
+		`{"sMessages": [], "fMessages": [], "data": [[], [{"id": 5, "ownerId": "testuser", "subject": "sent", "viewedDatetime": "06/11/2018"}]]}`,
+	}
+
+	soon := time.Now().Add(24 * time.Hour).Format(filelocker.DateFormat)
+	later := time.Now().Add(30 * 24 * time.Hour).Format(filelocker.DateFormat)
+	owned := `<?xml version="1.0"?><cli_response><messages></messages><data>` +
+		`<file id="20" name="soon.txt" expirationDate="` + soon + `"/>` +
+		`<file id="21" name="later.txt" expirationDate="` + later + `"/>` +
+		`</data></cli_response>`
+
+	var messagesPolls int
+	fl := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.String() {
+		case "/message/get_messages":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(messages[messagesPolls]))
+			messagesPolls++
+		case "/file/get_files_shared_with_user":
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte(`<?xml version="1.0"?><cli_response><messages></messages><data></data></cli_response>`))
+		case "/file/get_user_file_list":
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte(owned))
+		default:
+			t.Errorf("unexpected url %s", r.URL)
+		}
+	}))
+	defer fl.Close()
+
+	bURL, err := url.Parse(fl.URL)
+	if err != nil {
+		t.Error(err)
+	}
+
+	client := filelocker.Client{
+		Client:  http.DefaultClient,
+		Origin:  "123requestorigin321",
+		BaseURL: bURL,
+	}
+
+	watcher := filelocker.Watcher{Client: &client, Viewed: true, ExpiringWithin: 72 * time.Hour}
+
+	events, err := watcher.Poll()
+	if err != nil {
+		t.Fatal("error polling filelocker", err)
+	}
+
+	if len(events) != 1 || events[0].Type != filelocker.EventFileExpiring || events[0].File.ID != "20" {
+		t.Errorf("expected a single file.expiring event for file 20, got %+v", events)
+	}
+
+	events, err = watcher.Poll()
+	if err != nil {
+		t.Fatal("error polling filelocker", err)
+	}
+
+	if len(events) != 1 || events[0].Type != filelocker.EventMessageViewed || events[0].Message.ID != 5 {
+		t.Errorf("expected a single message.viewed event for message 5, got %+v", events)
+	}
+}
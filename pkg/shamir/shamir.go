@@ -0,0 +1,138 @@
+// Package shamir implements Shamir's secret sharing over GF(2^8).  A secret is split into
+// n shares, any k of which can be combined to recover it while fewer reveal nothing.
+package shamir
+
+import (
+	"crypto/rand"
+	"errors"
+)
+
+var (
+	expTable [255]byte
+	logTable [256]byte
+)
+
+func init() {
+	// build log and exp tables for GF(2^8) with the AES polynomial and generator 3
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		expTable[i] = x
+		logTable[x] = byte(i)
+
+		// multiply x by 3 (x*2 + x)
+		hi := x & 0x80
+		x2 := x << 1
+		if hi != 0 {
+			x2 ^= 0x1b
+		}
+		x ^= x2
+	}
+}
+
+func mul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return expTable[(int(logTable[a])+int(logTable[b]))%255]
+}
+
+func div(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return expTable[(int(logTable[a])-int(logTable[b])+255)%255]
+}
+
+// Split divides the secret into n shares, any k of which can recreate it.  Each share is
+// the length of the secret plus one byte identifying the share.
+func Split(secret []byte, n, k int) ([][]byte, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("cannot split an empty secret")
+	}
+
+	if k < 2 {
+		return nil, errors.New("threshold must be at least 2")
+	}
+
+	if n < k {
+		return nil, errors.New("number of shares must be at least the threshold")
+	}
+
+	if n > 255 {
+		return nil, errors.New("number of shares must be at most 255")
+	}
+
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][len(secret)] = byte(i + 1)
+	}
+
+	coefficients := make([]byte, k)
+	for b, s := range secret {
+		if _, err := rand.Read(coefficients[1:]); err != nil {
+			return nil, err
+		}
+		coefficients[0] = s
+
+		for _, share := range shares {
+			x := share[len(secret)]
+
+			// evaluate the polynomial at x using Horner's method
+			var y byte
+			for c := k - 1; c >= 0; c-- {
+				y = mul(y, x) ^ coefficients[c]
+			}
+			share[b] = y
+		}
+	}
+
+	return shares, nil
+}
+
+// Combine recreates a secret from at least the threshold number of shares.  Combining fewer
+// shares than the threshold returns garbage rather than an error.
+func Combine(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, errors.New("at least 2 shares are required")
+	}
+
+	size := len(shares[0])
+	if size < 2 {
+		return nil, errors.New("shares are too short")
+	}
+
+	xs := make([]byte, len(shares))
+	seen := make(map[byte]bool)
+	for i, share := range shares {
+		if len(share) != size {
+			return nil, errors.New("shares must all be the same length")
+		}
+
+		x := share[size-1]
+		if x == 0 || seen[x] {
+			return nil, errors.New("shares must have unique, non-zero identifiers")
+		}
+		seen[x] = true
+		xs[i] = x
+	}
+
+	secret := make([]byte, size-1)
+	for b := range secret {
+		// lagrange interpolation at x = 0
+		var y byte
+		for i, share := range shares {
+			basis := byte(1)
+			for j := range shares {
+				if i == j {
+					continue
+				}
+				basis = mul(basis, div(xs[j], xs[j]^xs[i]))
+			}
+			y ^= mul(share[b], basis)
+		}
+		secret[b] = y
+	}
+
+	return secret, nil
+}
@@ -0,0 +1,76 @@
+package shamir_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/YaleUniversity/go-filelocker/pkg/shamir"
+)
+
+func TestSplitCombine(t *testing.T) {
+	secret := []byte("correct horse battery staple")
+
+	shares, err := shamir.Split(secret, 5, 3)
+	if err != nil {
+		t.Fatal("error splitting secret", err)
+	}
+
+	if len(shares) != 5 {
+		t.Fatalf("expected 5 shares, got %d", len(shares))
+	}
+
+	for _, subset := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+		var parts [][]byte
+		for _, i := range subset {
+			parts = append(parts, shares[i])
+		}
+
+		actual, err := shamir.Combine(parts)
+		if err != nil {
+			t.Errorf("error combining shares %v: %s", subset, err)
+			continue
+		}
+
+		if !bytes.Equal(actual, secret) {
+			t.Errorf("expected shares %v to combine to %q, got %q", subset, secret, actual)
+		}
+	}
+
+	actual, err := shamir.Combine(shares[:2])
+	if err != nil {
+		t.Fatal("error combining shares", err)
+	}
+
+	if bytes.Equal(actual, secret) {
+		t.Error("expected fewer shares than the threshold not to recreate the secret")
+	}
+}
+
+func TestSplitErrors(t *testing.T) {
+	if _, err := shamir.Split([]byte("secret"), 3, 1); err == nil {
+		t.Error("expected error for threshold of 1, got nil")
+	}
+
+	if _, err := shamir.Split([]byte("secret"), 2, 3); err == nil {
+		t.Error("expected error for fewer shares than the threshold, got nil")
+	}
+
+	if _, err := shamir.Split([]byte{}, 3, 2); err == nil {
+		t.Error("expected error for empty secret, got nil")
+	}
+}
+
+func TestCombineErrors(t *testing.T) {
+	shares, err := shamir.Split([]byte("secret"), 3, 2)
+	if err != nil {
+		t.Fatal("error splitting secret", err)
+	}
+
+	if _, err := shamir.Combine([][]byte{shares[0], shares[0]}); err == nil {
+		t.Error("expected error for duplicate shares, got nil")
+	}
+
+	if _, err := shamir.Combine([][]byte{shares[0], shares[1][1:]}); err == nil {
+		t.Error("expected error for mismatched share lengths, got nil")
+	}
+}